@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const commandUsage = `usage:
+  tubely migrate [up | down [steps] | to <version> | status]
+  tubely reprocess <videoID|all>`
+
+// runCommand runs a one-off maintenance command instead of the server.
+func (cfg *apiConfig) runCommand(ctx context.Context, db database.Client, args []string) error {
+	if args[0] != "migrate" {
+		if err := migrateUp(db); err != nil {
+			return err
+		}
+	}
+
+	switch args[0] {
+	case "migrate":
+		return runMigrate(db, args[1:])
+	case "reprocess":
+		if len(args) != 2 {
+			return errors.New(commandUsage)
+		}
+		if args[1] == "all" {
+			done, err := cfg.reprocessAllVideos(ctx)
+			if err != nil {
+				return err
+			}
+			log.Printf("Reprocessed %d videos", done)
+			return nil
+		}
+
+		videoID, err := uuid.Parse(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid video ID: %w", err)
+		}
+		video, err := cfg.db.GetVideo(ctx, videoID)
+		if err != nil {
+			return err
+		}
+		_, err = cfg.reprocessVideo(ctx, video)
+		if err != nil {
+			return err
+		}
+		log.Printf("Reprocessed video %s", videoID)
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q\n%s", args[0], commandUsage)
+	}
+}
+
+func runMigrate(db database.Client, args []string) error {
+	if len(args) == 0 {
+		return migrateUp(db)
+	}
+
+	switch args[0] {
+	case "up":
+		return migrateUp(db)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+			steps = n
+		}
+		ran, err := db.MigrateDown(steps)
+		if err != nil {
+			return err
+		}
+		log.Printf("Rolled back %d migrations", ran)
+		return nil
+	case "to":
+		if len(args) != 2 {
+			return errors.New(commandUsage)
+		}
+		version, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		ran, err := db.MigrateTo(version)
+		if err != nil {
+			return err
+		}
+		log.Printf("Ran %d migrations, schema is at version %d", ran, version)
+		return nil
+	case "status":
+		statuses, err := db.MigrateStatus()
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				state = "applied"
+			}
+			fmt.Printf("%04d_%s\t%s\n", s.Version, s.Name, state)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command %q\n%s", args[0], commandUsage)
+	}
+}
+
+func migrateUp(db database.Client) error {
+	ran, err := db.MigrateUp()
+	if err != nil {
+		return err
+	}
+	if ran > 0 {
+		log.Printf("Applied %d migrations", ran)
+	}
+	return nil
+}
+
+// isInstantStorageClass reports whether objects in the storage class can be
+// downloaded straight away, which re-processing relies on.
+func isInstantStorageClass(class string) bool {
+	switch types.StorageClass(class) {
+	case "",
+		types.StorageClassStandard,
+		types.StorageClassStandardIa,
+		types.StorageClassOnezoneIa,
+		types.StorageClassIntelligentTiering,
+		types.StorageClassGlacierIr:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/bits"
+	"os/exec"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	// Frames sampled evenly across the video for the perceptual fingerprint
+	fingerprintFrames = 16
+
+	// Two frames match when their difference hashes differ in at most this many bits
+	frameHashMaxDistance = 10
+
+	// Share of matching frames needed to call two videos near-duplicates
+	nearDuplicateRatio = 0.8
+
+	// How far apart, in seconds, durations of near-duplicates can be
+	nearDuplicateDurationSlack = 1.0
+)
+
+const (
+	duplicatePolicyOff   = "off"
+	duplicatePolicyWarn  = "warn"
+	duplicatePolicyBlock = "block"
+
+	duplicateScopeUser   = "user"
+	duplicateScopeGlobal = "global"
+)
+
+// duplicateMatch is a video an upload duplicates. VideoID is only set for
+// the uploader's own videos, so a global scope doesn't reveal other users'
+// videos.
+type duplicateMatch struct {
+	VideoID    *uuid.UUID `json:"video_id"`
+	Exact      bool       `json:"exact"`
+	Similarity float64    `json:"similarity"`
+}
+
+// newDuplicateMatch reports other as a duplicate of the upload fingerprinted
+// by fp, hiding its ID when another user owns it.
+func newDuplicateMatch(fp, other database.Fingerprint, exact bool, similarity float64) duplicateMatch {
+	match := duplicateMatch{
+		Exact:      exact,
+		Similarity: similarity,
+	}
+	if other.UserID == fp.UserID {
+		match.VideoID = &other.VideoID
+	}
+	return match
+}
+
+// getFrameHashes samples frames across the video and returns a 64-bit
+// difference hash for each, computed from a 9x8 grayscale thumbnail.
+func getFrameHashes(filePath string, duration float64) ([]uint64, error) {
+	if duration <= 0 {
+		return nil, fmt.Errorf("invalid duration %f", duration)
+	}
+	rate := float64(fingerprintFrames) / duration
+
+	// Set the command
+	cmd := exec.Command(
+		"ffmpeg",
+		"-v",
+		"error",
+		"-i",
+		filePath,
+		"-vf",
+		fmt.Sprintf("fps=%f,scale=9:8:flags=area,format=gray", rate),
+		"-frames:v",
+		fmt.Sprint(fingerprintFrames),
+		"-f",
+		"rawvideo",
+		"-",
+	)
+
+	// Run the command
+	var b bytes.Buffer
+	cmd.Stdout = &b
+	err := cmd.Run()
+	if err != nil {
+		return nil, err
+	}
+
+	const frameSize = 9 * 8
+	raw := b.Bytes()
+	hashes := make([]uint64, 0, len(raw)/frameSize)
+	for len(raw) >= frameSize {
+		hashes = append(hashes, differenceHash(raw[:frameSize]))
+		raw = raw[frameSize:]
+	}
+	if len(hashes) == 0 {
+		return nil, fmt.Errorf("no frames sampled from video")
+	}
+	return hashes, nil
+}
+
+// differenceHash sets one bit per pixel that is brighter than its right neighbour.
+func differenceHash(pixels []byte) uint64 {
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if pixels[y*9+x] > pixels[y*9+x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// frameSimilarity returns the share of aligned frames whose hashes are close.
+func frameSimilarity(a, b []uint64) float64 {
+	n := min(len(a), len(b))
+	if n == 0 {
+		return 0
+	}
+	matches := 0
+	for i := 0; i < n; i++ {
+		if bits.OnesCount64(a[i]^b[i]) <= frameHashMaxDistance {
+			matches++
+		}
+	}
+	return float64(matches) / float64(max(len(a), len(b)))
+}
+
+// findDuplicates looks up videos in the configured scope that share the
+// upload's content hash or whose sampled frames are near-identical.
+func (cfg *apiConfig) findDuplicates(ctx context.Context, fp database.Fingerprint) ([]duplicateMatch, error) {
+	filter := database.FingerprintFilter{
+		ExcludeVideoID: fp.VideoID,
+	}
+	if cfg.duplicateScope == duplicateScopeUser {
+		filter.UserID = fp.UserID
+	}
+
+	matches := []duplicateMatch{}
+	seen := map[uuid.UUID]bool{}
+
+	filter.ContentHash = fp.ContentHash
+	exact, err := cfg.db.FindFingerprints(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	for _, other := range exact {
+		seen[other.VideoID] = true
+		matches = append(matches, newDuplicateMatch(fp, other, true, 1))
+	}
+
+	if len(fp.FrameHashes) == 0 {
+		return matches, nil
+	}
+
+	filter.ContentHash = ""
+	filter.MinDuration = fp.Duration - nearDuplicateDurationSlack
+	filter.MaxDuration = fp.Duration + nearDuplicateDurationSlack
+	candidates, err := cfg.db.FindFingerprints(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	for _, other := range candidates {
+		if seen[other.VideoID] {
+			continue
+		}
+		similarity := frameSimilarity(fp.FrameHashes, other.FrameHashes)
+		if similarity >= nearDuplicateRatio {
+			matches = append(matches, newDuplicateMatch(fp, other, false, similarity))
+		}
+	}
+
+	return matches, nil
+}
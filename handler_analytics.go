@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+const (
+	maxPlaybackSessionIDLength = 64
+	// Per client address, enough for a few players sending heartbeats
+	maxPlaybackEventsPerMinute = 120
+	defaultAnalyticsDays       = 30
+	maxAnalyticsDays           = 366
+	retentionPoints            = 20
+)
+
+// handlerPlaybackEventCreate ingests play, progress and complete events from
+// players. Anyone who can see the video can report playback; events are
+// grouped by the player's session_id so a viewing is counted once. Each
+// client address can send maxPlaybackEventsPerMinute events a minute.
+func (cfg *apiConfig) handlerPlaybackEventCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		SessionID string  `json:"session_id"`
+		Type      string  `json:"type"`
+		Position  float64 `json:"position"`
+	}
+
+	if ok, retryAfter := cfg.playbackEventLimiter.allow(clientIP(r), time.Now()); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+		respondWithError(w, http.StatusTooManyRequests, "Too many playback events, try again later", nil)
+		return
+	}
+
+	video, ok := cfg.getVisibleVideo(w, r)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	if params.SessionID == "" || len(params.SessionID) > maxPlaybackSessionIDLength {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("session_id must be 1 to %d characters", maxPlaybackSessionIDLength), nil)
+		return
+	}
+	switch params.Type {
+	case database.PlaybackEventPlay, database.PlaybackEventProgress, database.PlaybackEventComplete:
+	default:
+		respondWithError(w, http.StatusBadRequest, "type must be play, progress or complete", nil)
+		return
+	}
+	if params.Position < 0 || math.IsInf(params.Position, 0) || math.IsNaN(params.Position) ||
+		(video.Duration != nil && params.Position > *video.Duration+1) {
+		respondWithError(w, http.StatusBadRequest, "position is outside the video", nil)
+		return
+	}
+
+	err = cfg.db.RecordPlaybackEvent(r.Context(), database.PlaybackEvent{
+		VideoID:   video.ID,
+		SessionID: params.SessionID,
+		Type:      params.Type,
+		Position:  params.Position,
+		At:        time.Now(),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't record playback event", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type retentionPoint struct {
+	// Progress is the fraction of the video, Position the same in seconds
+	Progress float64 `json:"progress"`
+	Position float64 `json:"position"`
+	// Audience is the fraction of viewings that got this far
+	Audience float64 `json:"audience"`
+}
+
+// handlerVideoAnalyticsRetrieve returns daily views, watch time and
+// completions between from and to (YYYY-MM-DD, default the last 30 days),
+// their totals, and a retention curve for the viewings started in that
+// range.
+func (cfg *apiConfig) handlerVideoAnalyticsRetrieve(w http.ResponseWriter, r *http.Request) {
+	type totals struct {
+		Views       int     `json:"views"`
+		WatchTime   float64 `json:"watch_time"`
+		Completions int     `json:"completions"`
+	}
+	type response struct {
+		From      string                     `json:"from"`
+		To        string                     `json:"to"`
+		Totals    totals                     `json:"totals"`
+		Daily     []database.VideoDailyStats `json:"daily"`
+		Retention []retentionPoint           `json:"retention"`
+	}
+
+	video, ok := cfg.authorizeVideoOwner(w, r)
+	if !ok {
+		return
+	}
+
+	to := time.Now().UTC().Truncate(24 * time.Hour)
+	if v := r.URL.Query().Get("to"); v != "" {
+		t, err := time.Parse(database.StatsDayLayout, v)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "to must be a date like 2006-01-02", err)
+			return
+		}
+		to = t
+	}
+	from := to.AddDate(0, 0, -(defaultAnalyticsDays - 1))
+	if v := r.URL.Query().Get("from"); v != "" {
+		t, err := time.Parse(database.StatsDayLayout, v)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "from must be a date like 2006-01-02", err)
+			return
+		}
+		from = t
+	}
+	if from.After(to) {
+		respondWithError(w, http.StatusBadRequest, "from must not be after to", nil)
+		return
+	}
+	if to.Sub(from) >= maxAnalyticsDays*24*time.Hour {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Range can't be longer than %d days", maxAnalyticsDays), nil)
+		return
+	}
+
+	stats, err := cfg.db.GetVideoDailyStats(r.Context(), video.ID, from, to)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get playback stats", err)
+		return
+	}
+	positions, err := cfg.db.GetPlaybackPositions(r.Context(), video.ID, from, to)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get playback stats", err)
+		return
+	}
+
+	resp := response{
+		From:      from.Format(database.StatsDayLayout),
+		To:        to.Format(database.StatsDayLayout),
+		Daily:     fillDailyStats(stats, from, to),
+		Retention: []retentionPoint{},
+	}
+	for _, day := range stats {
+		resp.Totals.Views += day.Views
+		resp.Totals.WatchTime += day.WatchTime
+		resp.Totals.Completions += day.Completions
+	}
+	if video.Duration != nil && *video.Duration > 0 && len(positions) > 0 {
+		resp.Retention = retentionCurve(positions, *video.Duration)
+	}
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// fillDailyStats returns one entry per day from from to to, with zeros for
+// days without playback.
+func fillDailyStats(stats []database.VideoDailyStats, from, to time.Time) []database.VideoDailyStats {
+	byDay := map[string]database.VideoDailyStats{}
+	for _, day := range stats {
+		byDay[day.Day] = day
+	}
+
+	days := []database.VideoDailyStats{}
+	for t := from; !t.After(to); t = t.AddDate(0, 0, 1) {
+		day := t.Format(database.StatsDayLayout)
+		if _, ok := byDay[day]; !ok {
+			byDay[day] = database.VideoDailyStats{Day: day}
+		}
+		days = append(days, byDay[day])
+	}
+	return days
+}
+
+// retentionCurve gives, at evenly spaced points through the video, the
+// fraction of viewings that reached it.
+func retentionCurve(positions []float64, duration float64) []retentionPoint {
+	curve := make([]retentionPoint, retentionPoints+1)
+	for i := range curve {
+		progress := float64(i) / retentionPoints
+		position := progress * duration
+		reached := 0
+		for _, p := range positions {
+			if p >= position {
+				reached++
+			}
+		}
+		curve[i] = retentionPoint{
+			Progress: progress,
+			Position: position,
+			Audience: float64(reached) / float64(len(positions)),
+		}
+	}
+	return curve
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/captions"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// languagePattern matches BCP 47 style tags such as "en", "pt-BR" or "zh-Hant".
+var languagePattern = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+
+func (cfg *apiConfig) handlerCaptionUpload(w http.ResponseWriter, r *http.Request) {
+	// Set upload limit
+	const maxCaptionSize = 5 << 20
+	r.Body = http.MaxBytesReader(w, r.Body, maxCaptionSize)
+
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := cfg.validateJWT(r.Context(), token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(r.Context(), videoID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Couldn't find video", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to get video", err)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusUnauthorized, "User is not the video owner", nil)
+		return
+	}
+
+	language := r.FormValue("language")
+	if !languagePattern.MatchString(language) {
+		respondWithError(w, http.StatusBadRequest, "Invalid language tag", nil)
+		return
+	}
+	label := r.FormValue("label")
+	if label == "" {
+		label = language
+	}
+
+	// "caption" should match the HTML form input name
+	file, header, err := r.FormFile("caption")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Unable to parse form file", err)
+		return
+	}
+	defer file.Close()
+
+	format, err := getCaptionFormat(header.Header.Get("Content-Type"), header.Filename)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid caption format", err)
+		return
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Unable to read caption file", err)
+		return
+	}
+
+	// Parse and validate cue timing, converting SRT to WebVTT on the way
+	cues, err := captions.Parse(data, format)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid caption file: %v", err), err)
+		return
+	}
+
+	rndmString, err := randomObjectName()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "error reading from crypto/rand", err)
+		return
+	}
+	key := fmt.Sprintf("captions/%s.vtt", rndmString)
+
+	captionURL, err := cfg.putObject(r.Context(), key, "text/vtt", bytes.NewReader(captions.WriteVTT(cues)))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to upload caption", err)
+		return
+	}
+
+	caption, err := cfg.db.UpsertCaption(r.Context(), database.CreateCaptionParams{
+		VideoID:  videoID,
+		Language: language,
+		Label:    label,
+		URL:      captionURL,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save caption", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, caption)
+}
+
+func (cfg *apiConfig) handlerCaptionsRetrieve(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.getVisibleVideo(w, r)
+	if !ok {
+		return
+	}
+
+	captionList, err := cfg.db.GetCaptions(r.Context(), video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve captions", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, captionList)
+}
+
+func (cfg *apiConfig) handlerCaptionDelete(w http.ResponseWriter, r *http.Request) {
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+	language := r.PathValue("language")
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := cfg.validateJWT(r.Context(), token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(r.Context(), videoID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Couldn't find video", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You can't delete captions for this video", nil)
+		return
+	}
+
+	err = cfg.db.DeleteCaption(r.Context(), videoID, language)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Couldn't find caption", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete caption", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getCaptionFormat works out the caption format from the part's media type,
+// falling back to the file extension since browsers rarely know about SRT.
+func getCaptionFormat(headerType, filename string) (captions.Format, error) {
+	mediaType := ""
+	if headerType != "" {
+		parsed, _, err := mime.ParseMediaType(headerType)
+		if err != nil {
+			return "", err
+		}
+		mediaType = parsed
+	}
+
+	switch mediaType {
+	case "text/vtt":
+		return captions.FormatWebVTT, nil
+	case "application/x-subrip", "text/srt":
+		return captions.FormatSRT, nil
+	}
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".vtt":
+		return captions.FormatWebVTT, nil
+	case ".srt":
+		return captions.FormatSRT, nil
+	}
+	return "", fmt.Errorf("unsupported caption type %q", mediaType)
+}
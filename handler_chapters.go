@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/captions"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	maxChapters           = 100
+	maxChapterTitleLength = 100
+
+	// Scene detection settings
+	sceneChangeThreshold = 0.4
+	minSceneChapterGap   = 30.0
+	maxSceneChapters     = 20
+)
+
+func (cfg *apiConfig) handlerChaptersUpdate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Chapters []database.CreateChapterParams `json:"chapters"`
+	}
+
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := cfg.validateJWT(r.Context(), token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(r.Context(), videoID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Couldn't find video", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You can't edit chapters for this video", nil)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	err = validateChapters(params.Chapters, video.Duration)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	chapters, err := cfg.db.ReplaceChapters(r.Context(), videoID, params.Chapters)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save chapters", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, chapters)
+}
+
+func (cfg *apiConfig) handlerChaptersRetrieve(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.getVisibleVideo(w, r)
+	if !ok {
+		return
+	}
+
+	chapters, err := cfg.db.GetChapters(r.Context(), video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chapters", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, chapters)
+}
+
+// handlerChaptersVTT exports the chapters as a WebVTT chapters track.
+func (cfg *apiConfig) handlerChaptersVTT(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.getVisibleVideo(w, r)
+	if !ok {
+		return
+	}
+
+	chapters, err := cfg.db.GetChapters(r.Context(), video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chapters", err)
+		return
+	}
+	if len(chapters) == 0 {
+		respondWithError(w, http.StatusNotFound, "Video has no chapters", nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/vtt")
+	w.WriteHeader(http.StatusOK)
+	w.Write(captions.WriteVTT(chapterCues(chapters, video.Duration)))
+}
+
+func validateChapters(chapters []database.CreateChapterParams, duration *float64) error {
+	if len(chapters) > maxChapters {
+		return fmt.Errorf("A video can have at most %d chapters", maxChapters)
+	}
+	for i, chapter := range chapters {
+		if strings.TrimSpace(chapter.Title) == "" {
+			return fmt.Errorf("Chapter %d needs a title", i+1)
+		}
+		if len(chapter.Title) > maxChapterTitleLength {
+			return fmt.Errorf("Chapter %d title is longer than %d characters", i+1, maxChapterTitleLength)
+		}
+		if chapter.StartTime < 0 {
+			return fmt.Errorf("Chapter %d starts before the video", i+1)
+		}
+		if duration != nil && chapter.StartTime >= *duration {
+			return fmt.Errorf("Chapter %d starts after the video ends", i+1)
+		}
+		if i > 0 && chapter.StartTime <= chapters[i-1].StartTime {
+			return fmt.Errorf("Chapter %d must start after chapter %d", i+1, i)
+		}
+	}
+	return nil
+}
+
+// chapterCues turns chapters into cues that each run until the next chapter.
+// Without a known duration the last chapter is given a one second cue.
+func chapterCues(chapters []database.Chapter, duration *float64) []captions.Cue {
+	cues := make([]captions.Cue, 0, len(chapters))
+	for i, chapter := range chapters {
+		end := chapter.StartTime + 1
+		if i+1 < len(chapters) {
+			end = chapters[i+1].StartTime
+		} else if duration != nil && *duration > chapter.StartTime {
+			end = *duration
+		}
+		cues = append(cues, captions.Cue{
+			ID:    strconv.Itoa(i + 1),
+			Start: secondsToDuration(chapter.StartTime),
+			End:   secondsToDuration(end),
+			Text:  chapter.Title,
+		})
+	}
+	return cues
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+var scenePTSPattern = regexp.MustCompile(`pts_time:([0-9.]+)`)
+
+// detectSceneChapters runs an ffmpeg scene-change pass over the video and
+// suggests chapter boundaries at the most prominent cuts.
+func detectSceneChapters(filePath string) ([]database.CreateChapterParams, error) {
+	// Set the command
+	cmd := exec.Command(
+		"ffmpeg",
+		"-i",
+		filePath,
+		"-filter:v",
+		fmt.Sprintf("select='gt(scene,%.2f)',showinfo", sceneChangeThreshold),
+		"-an",
+		"-f",
+		"null",
+		"-",
+	)
+
+	// Run the command, showinfo writes to stderr
+	var b bytes.Buffer
+	cmd.Stderr = &b
+	err := cmd.Run()
+	if err != nil {
+		return nil, err
+	}
+
+	sceneTimes := []float64{}
+	for _, match := range scenePTSPattern.FindAllStringSubmatch(b.String(), -1) {
+		t, err := strconv.ParseFloat(match[1], 64)
+		if err != nil {
+			continue
+		}
+		sceneTimes = append(sceneTimes, t)
+	}
+	sort.Float64s(sceneTimes)
+
+	return suggestChapters(sceneTimes), nil
+}
+
+func suggestChapters(sceneTimes []float64) []database.CreateChapterParams {
+	chapters := []database.CreateChapterParams{
+		{Title: "Chapter 1", StartTime: 0},
+	}
+	last := 0.0
+	for _, t := range sceneTimes {
+		if len(chapters) >= maxSceneChapters {
+			break
+		}
+		if t-last < minSceneChapterGap {
+			continue
+		}
+		chapters = append(chapters, database.CreateChapterParams{
+			Title:     fmt.Sprintf("Chapter %d", len(chapters)+1),
+			StartTime: t,
+		})
+		last = t
+	}
+	if len(chapters) == 1 {
+		return nil
+	}
+	return chapters
+}
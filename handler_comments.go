@@ -0,0 +1,383 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	maxCommentLength     = 2000
+	defaultCommentPage   = 20
+	maxCommentPage       = 100
+	maxCommentsPerMinute = 5
+	maxCommentsPerDay    = 200
+)
+
+var commentRateLimits = []database.CommentRateLimit{
+	{Window: time.Minute, Max: maxCommentsPerMinute},
+	{Window: 24 * time.Hour, Max: maxCommentsPerDay},
+}
+
+func (cfg *apiConfig) handlerCommentsRetrieve(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.getVisibleVideo(w, r)
+	if !ok {
+		return
+	}
+
+	limit, offset, err := parseCommentPage(r.URL.Query())
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	page, err := cfg.db.GetComments(r.Context(), database.GetCommentsParams{
+		VideoID: video.ID,
+		Limit:   limit,
+		Offset:  offset,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve comments", err)
+		return
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(page.Total))
+	respondWithJSON(w, http.StatusOK, page.Comments)
+}
+
+func (cfg *apiConfig) handlerCommentRepliesRetrieve(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.getVisibleVideo(w, r)
+	if !ok {
+		return
+	}
+	comment, ok := cfg.getVideoComment(w, r, video)
+	if !ok {
+		return
+	}
+
+	limit, offset, err := parseCommentPage(r.URL.Query())
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	page, err := cfg.db.GetComments(r.Context(), database.GetCommentsParams{
+		VideoID:  video.ID,
+		ParentID: &comment.ID,
+		Limit:    limit,
+		Offset:   offset,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve replies", err)
+		return
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(page.Total))
+	respondWithJSON(w, http.StatusOK, page.Comments)
+}
+
+// handlerCommentCreate posts a comment, or a reply when parent_id names a
+// top-level comment of the same video. Replies can't be replied to.
+func (cfg *apiConfig) handlerCommentCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Body     string     `json:"body"`
+		ParentID *uuid.UUID `json:"parent_id"`
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := cfg.validateJWT(r.Context(), token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	video, ok := cfg.getVisibleVideo(w, r)
+	if !ok {
+		return
+	}
+	if video.CommentsDisabled {
+		respondWithError(w, http.StatusForbidden, "Comments are disabled for this video", nil)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	params.Body, err = validateCommentBody(params.Body)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	if params.ParentID != nil {
+		parent, err := cfg.db.GetComment(r.Context(), *params.ParentID)
+		if errors.Is(err, database.ErrNotFound) || (err == nil && parent.VideoID != video.ID) {
+			respondWithError(w, http.StatusBadRequest, "Couldn't find the comment to reply to", err)
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get comment", err)
+			return
+		}
+		if parent.ParentID != nil {
+			respondWithError(w, http.StatusBadRequest, "Replies can't be replied to", nil)
+			return
+		}
+	}
+
+	comment, err := cfg.db.CreateComment(r.Context(), database.CreateCommentParams{
+		VideoID:  video.ID,
+		UserID:   userID,
+		ParentID: params.ParentID,
+		Body:     params.Body,
+	}, commentRateLimits...)
+	var limitErr database.CommentRateLimitError
+	if errors.As(err, &limitErr) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(limitErr.Limit.Window.Seconds())))
+		respondWithError(w, http.StatusTooManyRequests, "You're commenting too often, try again later", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create comment", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, comment)
+}
+
+func (cfg *apiConfig) handlerCommentUpdate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Body string `json:"body"`
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := cfg.validateJWT(r.Context(), token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	video, ok := cfg.getVisibleVideo(w, r)
+	if !ok {
+		return
+	}
+	comment, ok := cfg.getVideoComment(w, r, video)
+	if !ok {
+		return
+	}
+	if comment.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You can't edit this comment", nil)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	params.Body, err = validateCommentBody(params.Body)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	comment, err = cfg.db.UpdateComment(r.Context(), comment.ID, params.Body)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Couldn't find comment", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update comment", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, comment)
+}
+
+// handlerCommentDelete lets the author or the video's owner delete a
+// comment. Deleting a comment deletes its replies.
+func (cfg *apiConfig) handlerCommentDelete(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := cfg.validateJWT(r.Context(), token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	video, ok := cfg.getVisibleVideo(w, r)
+	if !ok {
+		return
+	}
+	comment, ok := cfg.getVideoComment(w, r, video)
+	if !ok {
+		return
+	}
+	if comment.UserID != userID && video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You can't delete this comment", nil)
+		return
+	}
+
+	err = cfg.db.DeleteComment(r.Context(), comment.ID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Couldn't find comment", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete comment", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerCommentPin lets the video's owner pin a top-level comment above
+// the others, replacing any comment pinned before.
+func (cfg *apiConfig) handlerCommentPin(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Pinned bool `json:"pinned"`
+	}
+
+	video, ok := cfg.authorizeVideoOwner(w, r)
+	if !ok {
+		return
+	}
+	comment, ok := cfg.getVideoComment(w, r, video)
+	if !ok {
+		return
+	}
+	if comment.ParentID != nil {
+		respondWithError(w, http.StatusBadRequest, "Replies can't be pinned", nil)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	err = cfg.db.PinComment(r.Context(), comment.ID, params.Pinned)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Couldn't find comment", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't pin comment", err)
+		return
+	}
+
+	comment.Pinned = params.Pinned
+	respondWithJSON(w, http.StatusOK, comment)
+}
+
+// handlerCommentSettingsUpdate turns new comments on a video on or off.
+// Existing comments stay visible.
+func (cfg *apiConfig) handlerCommentSettingsUpdate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Disabled bool `json:"disabled"`
+	}
+
+	video, ok := cfg.authorizeVideoOwner(w, r)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	video, err = cfg.db.SetCommentsDisabled(r.Context(), video.ID, params.Disabled)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Couldn't find video", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update video", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, video)
+}
+
+// getVideoComment loads the comment in the path, writing the error
+// response when it doesn't exist or belongs to another video.
+func (cfg *apiConfig) getVideoComment(w http.ResponseWriter, r *http.Request, video database.Video) (database.Comment, bool) {
+	commentIDString := r.PathValue("commentID")
+	commentID, err := uuid.Parse(commentIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid comment ID", err)
+		return database.Comment{}, false
+	}
+
+	comment, err := cfg.db.GetComment(r.Context(), commentID)
+	if errors.Is(err, database.ErrNotFound) || (err == nil && comment.VideoID != video.ID) {
+		respondWithError(w, http.StatusNotFound, "Couldn't find comment", err)
+		return database.Comment{}, false
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get comment", err)
+		return database.Comment{}, false
+	}
+	return comment, true
+}
+
+func validateCommentBody(body string) (string, error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return "", errors.New("Comment can't be empty")
+	}
+	if len(body) > maxCommentLength {
+		return "", fmt.Errorf("Comment is longer than %d characters", maxCommentLength)
+	}
+	return body, nil
+}
+
+func parseCommentPage(query url.Values) (limit, offset int, err error) {
+	limit = defaultCommentPage
+	if v := query.Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxCommentPage {
+			return 0, 0, fmt.Errorf("limit must be between 1 and %d", maxCommentPage)
+		}
+	}
+	if v := query.Get("offset"); v != "" {
+		offset, err = strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return 0, 0, errors.New("offset must not be negative")
+		}
+	}
+	return limit, offset, nil
+}
@@ -0,0 +1,465 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	maxPlaylistTitleLength       = 100
+	maxPlaylistDescriptionLength = 5000
+)
+
+func (cfg *apiConfig) handlerPlaylistCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		database.CreatePlaylistParams
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := cfg.validateJWT(r.Context(), token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	params.UserID = userID
+	if params.Visibility == "" {
+		params.Visibility = database.VisibilityPrivate
+	}
+
+	err = validatePlaylist(params.CreatePlaylistParams)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	playlist, err := cfg.db.CreatePlaylist(r.Context(), params.CreatePlaylistParams)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create playlist", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, playlist)
+}
+
+func (cfg *apiConfig) handlerPlaylistsRetrieve(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := cfg.validateJWT(r.Context(), token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	playlists, err := cfg.db.GetPlaylists(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve playlists", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, playlists)
+}
+
+// handlerPlaylistGet returns a playlist with the videos the caller can see.
+// Unlisted and public playlists can be read by anyone, private ones only by
+// their owner.
+func (cfg *apiConfig) handlerPlaylistGet(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		database.Playlist
+		Items []database.PlaylistItem `json:"items"`
+	}
+
+	playlistIDString := r.PathValue("playlistID")
+	playlistID, err := uuid.Parse(playlistIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid playlist ID", err)
+		return
+	}
+
+	playlist, err := cfg.db.GetPlaylist(r.Context(), playlistID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Couldn't find playlist", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get playlist", err)
+		return
+	}
+
+	userID, err := cfg.optionalUserID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+	if !visibleTo(playlist.Visibility, playlist.UserID, userID) {
+		// Don't reveal that a private playlist exists
+		respondWithError(w, http.StatusNotFound, "Couldn't find playlist", nil)
+		return
+	}
+
+	items, err := cfg.db.GetPlaylistItems(r.Context(), playlistID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get playlist items", err)
+		return
+	}
+
+	// Leave out videos the caller isn't allowed to see
+	items = slices.DeleteFunc(items, func(item database.PlaylistItem) bool {
+		return !visibleTo(item.Video.Visibility, item.Video.UserID, userID)
+	})
+
+	// Fall back to the first video's thumbnail
+	if playlist.ThumbnailURL == nil && len(items) > 0 {
+		playlist.ThumbnailURL = items[0].Video.ThumbnailURL
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		Playlist: playlist,
+		Items:    items,
+	})
+}
+
+func (cfg *apiConfig) handlerPlaylistUpdate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+		Visibility  string `json:"visibility"`
+	}
+
+	playlist, ok := cfg.authorizePlaylistOwner(w, r)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	playlist.Title = params.Title
+	playlist.Description = params.Description
+	if params.Visibility != "" {
+		playlist.Visibility = params.Visibility
+	}
+	err = validatePlaylist(playlist.CreatePlaylistParams)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	err = cfg.db.UpdatePlaylist(r.Context(), playlist)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Couldn't find playlist", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update playlist", err)
+		return
+	}
+
+	playlist, err = cfg.db.GetPlaylist(r.Context(), playlist.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get playlist", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, playlist)
+}
+
+func (cfg *apiConfig) handlerPlaylistDelete(w http.ResponseWriter, r *http.Request) {
+	playlist, ok := cfg.authorizePlaylistOwner(w, r)
+	if !ok {
+		return
+	}
+
+	err := cfg.db.DeletePlaylist(r.Context(), playlist.ID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Couldn't find playlist", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete playlist", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerPlaylistThumbnailUpload(w http.ResponseWriter, r *http.Request) {
+	playlist, ok := cfg.authorizePlaylistOwner(w, r)
+	if !ok {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxThumbnailSize)
+	const maxMemory = 10 << 20
+	r.ParseMultipartForm(maxMemory)
+
+	file, header, err := r.FormFile("thumbnail")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Unable to parse form file", err)
+		return
+	}
+	defer file.Close()
+
+	mediaType, _, err := mime.ParseMediaType(header.Header.Get("Content-Type"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid media type", err)
+		return
+	}
+	if mediaType != "image/jpeg" && mediaType != "image/png" {
+		respondWithError(w, http.StatusBadRequest, "Invalid media type", nil)
+		return
+	}
+
+	assetURL, err := cfg.saveThumbnail(file, mediaType)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to save thumbnail", err)
+		return
+	}
+
+	playlist.ThumbnailURL = &assetURL
+	err = cfg.db.UpdatePlaylist(r.Context(), playlist)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to update playlist's thumbnail URL", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, playlist)
+}
+
+func (cfg *apiConfig) handlerPlaylistItemAdd(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		VideoID uuid.UUID `json:"video_id"`
+		// Position is where to insert the video, it is appended when unset.
+		Position *int `json:"position"`
+	}
+
+	playlist, ok := cfg.authorizePlaylistOwner(w, r)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(r.Context(), params.VideoID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Couldn't find video", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.UserID != playlist.UserID {
+		respondWithError(w, http.StatusForbidden, "You can only add your own videos to a playlist", nil)
+		return
+	}
+
+	item, err := cfg.db.AddPlaylistItem(r.Context(), playlist.ID, video.ID, params.Position)
+	if errors.Is(err, database.ErrConflict) {
+		respondWithError(w, http.StatusConflict, "Video is already in the playlist", err)
+		return
+	}
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Couldn't find playlist", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't add video to playlist", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, item)
+}
+
+// handlerPlaylistItemsReorder sets the order of every item at once.
+func (cfg *apiConfig) handlerPlaylistItemsReorder(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		ItemIDs []uuid.UUID `json:"item_ids"`
+	}
+
+	playlist, ok := cfg.authorizePlaylistOwner(w, r)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	err = cfg.db.ReorderPlaylistItems(r.Context(), playlist.ID, params.ItemIDs)
+	if errors.Is(err, database.ErrInvalidPlaylistOrder) {
+		respondWithError(w, http.StatusBadRequest, "item_ids must list every playlist item once", err)
+		return
+	}
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Couldn't find playlist", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't reorder playlist", err)
+		return
+	}
+
+	cfg.respondWithPlaylistItems(w, r, playlist.ID)
+}
+
+// handlerPlaylistItemMove moves one item to a new position, shifting the
+// items in between.
+func (cfg *apiConfig) handlerPlaylistItemMove(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Position int `json:"position"`
+	}
+
+	playlist, ok := cfg.authorizePlaylistOwner(w, r)
+	if !ok {
+		return
+	}
+
+	itemID, err := uuid.Parse(r.PathValue("itemID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid item ID", err)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	err = cfg.db.MovePlaylistItem(r.Context(), playlist.ID, itemID, params.Position)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Couldn't find playlist item", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't move playlist item", err)
+		return
+	}
+
+	cfg.respondWithPlaylistItems(w, r, playlist.ID)
+}
+
+func (cfg *apiConfig) handlerPlaylistItemDelete(w http.ResponseWriter, r *http.Request) {
+	playlist, ok := cfg.authorizePlaylistOwner(w, r)
+	if !ok {
+		return
+	}
+
+	itemID, err := uuid.Parse(r.PathValue("itemID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid item ID", err)
+		return
+	}
+
+	err = cfg.db.RemovePlaylistItem(r.Context(), playlist.ID, itemID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Couldn't find playlist item", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't remove playlist item", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) respondWithPlaylistItems(w http.ResponseWriter, r *http.Request, playlistID uuid.UUID) {
+	items, err := cfg.db.GetPlaylistItems(r.Context(), playlistID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get playlist items", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, items)
+}
+
+// authorizePlaylistOwner loads the playlist named in the path and checks the
+// caller owns it, writing an error response when they don't.
+func (cfg *apiConfig) authorizePlaylistOwner(w http.ResponseWriter, r *http.Request) (database.Playlist, bool) {
+	playlistIDString := r.PathValue("playlistID")
+	playlistID, err := uuid.Parse(playlistIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid playlist ID", err)
+		return database.Playlist{}, false
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return database.Playlist{}, false
+	}
+	userID, err := cfg.validateJWT(r.Context(), token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return database.Playlist{}, false
+	}
+
+	playlist, err := cfg.db.GetPlaylist(r.Context(), playlistID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Couldn't find playlist", err)
+		return database.Playlist{}, false
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get playlist", err)
+		return database.Playlist{}, false
+	}
+	if playlist.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You can't edit this playlist", nil)
+		return database.Playlist{}, false
+	}
+	return playlist, true
+}
+
+func validatePlaylist(params database.CreatePlaylistParams) error {
+	if strings.TrimSpace(params.Title) == "" {
+		return errors.New("Playlist needs a title")
+	}
+	if len(params.Title) > maxPlaylistTitleLength {
+		return fmt.Errorf("Playlist title is longer than %d characters", maxPlaylistTitleLength)
+	}
+	if len(params.Description) > maxPlaylistDescriptionLength {
+		return fmt.Errorf("Playlist description is longer than %d characters", maxPlaylistDescriptionLength)
+	}
+	return validateVisibility(params.Visibility)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+type reactionsResponse struct {
+	Reactions  map[string]int `json:"reactions"`
+	MyReaction *string        `json:"my_reaction"`
+}
+
+// handlerVideoReactionUpdate sets the caller's reaction to a video,
+// replacing any reaction they had. Sending the same reaction again changes
+// nothing.
+func (cfg *apiConfig) handlerVideoReactionUpdate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Reaction string `json:"reaction"`
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := cfg.validateJWT(r.Context(), token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	video, ok := cfg.getVisibleVideo(w, r)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if !database.IsReaction(params.Reaction) {
+		msg := fmt.Sprintf("Reaction must be one of %s", strings.Join(database.Reactions, ", "))
+		respondWithError(w, http.StatusBadRequest, msg, nil)
+		return
+	}
+
+	err = cfg.db.SetVideoReaction(r.Context(), video.ID, userID, params.Reaction)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save reaction", err)
+		return
+	}
+
+	cfg.respondWithReactions(w, r, video.ID, userID)
+}
+
+func (cfg *apiConfig) handlerVideoReactionDelete(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := cfg.validateJWT(r.Context(), token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	video, ok := cfg.getVisibleVideo(w, r)
+	if !ok {
+		return
+	}
+
+	err = cfg.db.DeleteVideoReaction(r.Context(), video.ID, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't remove reaction", err)
+		return
+	}
+
+	cfg.respondWithReactions(w, r, video.ID, userID)
+}
+
+// respondWithReactions reports a video's counters as they are after a
+// change, together with the caller's own reaction.
+func (cfg *apiConfig) respondWithReactions(w http.ResponseWriter, r *http.Request, videoID, userID uuid.UUID) {
+	video, err := cfg.db.GetVideo(r.Context(), videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	myReaction, err := cfg.getMyReaction(r, videoID, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get reaction", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, reactionsResponse{
+		Reactions:  video.Reactions,
+		MyReaction: myReaction,
+	})
+}
+
+// getMyReaction returns the user's reaction to a video, nil when they
+// haven't reacted or aren't logged in.
+func (cfg *apiConfig) getMyReaction(r *http.Request, videoID, userID uuid.UUID) (*string, error) {
+	if userID == uuid.Nil {
+		return nil, nil
+	}
+	reaction, err := cfg.db.GetVideoReaction(r.Context(), videoID, userID)
+	if err != nil || reaction == "" {
+		return nil, err
+	}
+	return &reaction, nil
+}
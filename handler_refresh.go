@@ -1,15 +1,24 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
 )
 
+// handlerRefresh exchanges a refresh token for a new access token and a new
+// refresh token. The old refresh token stops working, and presenting it
+// again revokes the whole session, since that means it was copied. Every
+// refresh extends the session by refreshTokenTTL, so an active session
+// never runs out.
 func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 	type response struct {
-		Token string `json:"token"`
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
 	}
 
 	refreshToken, err := auth.GetBearerToken(r.Header)
@@ -17,17 +26,52 @@ func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusBadRequest, "Couldn't find token", err)
 		return
 	}
+	old, err := cfg.getRefreshToken(r.Context(), refreshToken)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate refresh token", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get refresh token", err)
+		return
+	}
+	user, err := cfg.db.GetUser(r.Context(), old.UserID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user for refresh token", err)
+		return
+	}
 
-	user, err := cfg.db.GetUserByRefreshToken(refreshToken)
+	newRefreshToken, err := auth.MakeRefreshToken()
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Couldn't get user for refresh token", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create refresh token", err)
+		return
+	}
+
+	_, err = cfg.db.RotateRefreshToken(r.Context(), old.ID, database.CreateRefreshTokenParams{
+		ID:        newRefreshToken.ID,
+		TokenHash: newRefreshToken.Hash(),
+		ExpiresAt: time.Now().UTC().Add(cfg.refreshTokenTTL),
+		UserAgent: r.UserAgent(),
+		IP:        clientIP(r),
+	})
+	if errors.Is(err, database.ErrTokenReused) {
+		respondWithError(w, http.StatusUnauthorized, "Refresh token was already used, log in again", err)
+		return
+	}
+	if errors.Is(err, database.ErrNotFound) || errors.Is(err, database.ErrTokenRevoked) || errors.Is(err, database.ErrTokenExpired) {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate refresh token", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't rotate refresh token", err)
 		return
 	}
 
 	accessToken, err := auth.MakeJWT(
 		user.ID,
+		user.TokenVersion,
 		cfg.jwtSecret,
-		time.Hour,
+		cfg.accessTokenTTL,
 	)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Couldn't validate token", err)
@@ -35,7 +79,8 @@ func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 	}
 
 	respondWithJSON(w, http.StatusOK, response{
-		Token: accessToken,
+		Token:        accessToken,
+		RefreshToken: newRefreshToken.String(),
 	})
 }
 
@@ -46,7 +91,14 @@ func (cfg *apiConfig) handlerRevoke(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = cfg.db.RevokeRefreshToken(refreshToken)
+	rt, err := cfg.getRefreshToken(r.Context(), refreshToken)
+	if err == nil {
+		err = cfg.db.RevokeRefreshToken(r.Context(), rt.ID)
+	}
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Couldn't find session", err)
+		return
+	}
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke session", err)
 		return
@@ -54,3 +106,21 @@ func (cfg *apiConfig) handlerRevoke(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// getRefreshToken looks up a refresh token sent by a client and checks its
+// secret against the stored hash. Malformed, unknown and forged tokens are
+// all reported as database.ErrNotFound.
+func (cfg *apiConfig) getRefreshToken(ctx context.Context, token string) (database.RefreshToken, error) {
+	parsed, err := auth.ParseRefreshToken(token)
+	if err != nil {
+		return database.RefreshToken{}, database.ErrNotFound
+	}
+	rt, err := cfg.db.GetRefreshToken(ctx, parsed.ID)
+	if err != nil {
+		return database.RefreshToken{}, err
+	}
+	if !auth.CheckRefreshTokenHash(parsed, rt.TokenHash) {
+		return database.RefreshToken{}, database.ErrNotFound
+	}
+	return rt, nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) handlerVideoRevisionsRetrieve(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.authorizeVideoOwner(w, r)
+	if !ok {
+		return
+	}
+
+	revisions, err := cfg.db.GetVideoRevisions(r.Context(), video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve revisions", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, revisions)
+}
+
+// handlerVideoRevisionRollback puts a video's file or thumbnail back to how
+// it was after the given revision. The rollback is itself a new revision.
+func (cfg *apiConfig) handlerVideoRevisionRollback(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.authorizeVideoOwner(w, r)
+	if !ok {
+		return
+	}
+
+	revisionIDString := r.PathValue("revisionID")
+	revisionID, err := uuid.Parse(revisionIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid revision ID", err)
+		return
+	}
+
+	video, err = cfg.db.RollbackVideoRevision(r.Context(), video.ID, revisionID, video.UserID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Couldn't find revision", err)
+		return
+	}
+	if errors.Is(err, database.ErrNotMediaRevision) {
+		respondWithError(w, http.StatusBadRequest, "Only video and thumbnail revisions can be rolled back to", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't roll back video", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, video)
+}
+
+// authorizeVideoOwner loads the video in the path and checks that the caller
+// owns it, writing the error response when they don't.
+func (cfg *apiConfig) authorizeVideoOwner(w http.ResponseWriter, r *http.Request) (database.Video, bool) {
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return database.Video{}, false
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return database.Video{}, false
+	}
+	userID, err := cfg.validateJWT(r.Context(), token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return database.Video{}, false
+	}
+
+	video, err := cfg.db.GetVideo(r.Context(), videoID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Couldn't find video", err)
+		return database.Video{}, false
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return database.Video{}, false
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You don't own this video", nil)
+		return database.Video{}, false
+	}
+	return video, true
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+const maxSearchQueryLength = 200
+
+func (cfg *apiConfig) handlerVideosSearch(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := cfg.validateJWT(r.Context(), token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	query := r.URL.Query()
+	params := database.SearchVideosParams{
+		UserID: userID,
+		Query:  query.Get("q"),
+		Limit:  database.DefaultVideoPageSize,
+	}
+	if len(params.Query) > maxSearchQueryLength {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Search query must be at most %d characters", maxSearchQueryLength), nil)
+		return
+	}
+	if limit := query.Get("limit"); limit != "" {
+		params.Limit, err = strconv.Atoi(limit)
+		if err != nil || params.Limit < 1 || params.Limit > database.MaxVideoPageSize {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", database.MaxVideoPageSize), err)
+			return
+		}
+	}
+	if offset := query.Get("offset"); offset != "" {
+		params.Offset, err = strconv.Atoi(offset)
+		if err != nil || params.Offset < 0 {
+			respondWithError(w, http.StatusBadRequest, "offset must not be negative", err)
+			return
+		}
+	}
+
+	page, err := cfg.db.SearchVideos(r.Context(), params)
+	if errors.Is(err, database.ErrEmptySearch) {
+		respondWithError(w, http.StatusBadRequest, "Search query is empty", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't search videos", err)
+		return
+	}
+
+	for i := range page.Results {
+		page.Results[i].TitleHighlight = highlightHTML(page.Results[i].TitleHighlight)
+		page.Results[i].Snippet = highlightHTML(page.Results[i].Snippet)
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(page.Total))
+	respondWithJSON(w, http.StatusOK, page.Results)
+}
+
+// highlightHTML escapes a highlighted search field and wraps its matches
+// in <mark> elements.
+func highlightHTML(s string) string {
+	return strings.NewReplacer(
+		database.HighlightStart, "<mark>",
+		database.HighlightEnd, "</mark>",
+	).Replace(html.EscapeString(s))
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"mime"
@@ -12,10 +13,17 @@ import (
 	"strings"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
 	"github.com/google/uuid"
 )
 
+// maxThumbnailSize caps thumbnail uploads for videos and playlists.
+const maxThumbnailSize = 10 << 20
+
 func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Request) {
+	// Set upload limit
+	r.Body = http.MaxBytesReader(w, r.Body, maxThumbnailSize)
+
 	videoIDString := r.PathValue("videoID")
 	videoID, err := uuid.Parse(videoIDString)
 	if err != nil {
@@ -29,7 +37,7 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	userID, err := cfg.validateJWT(r.Context(), token)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
 		return
@@ -62,9 +70,13 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 	}
 
 	// Get video metadata
-	video, err := cfg.db.GetVideo(videoID)
+	video, err := cfg.db.GetVideo(r.Context(), videoID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Couldn't find video", err)
+		return
+	}
 	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Unable to find video", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to get video", err)
 		return
 	}
 	if video.UserID != userID {
@@ -72,46 +84,51 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	assetURL, err := cfg.saveThumbnail(file, mediaType)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to save thumbnail", err)
+		return
+	}
+
+	// Update video metadata for new thumbnail URL
+	video.ThumbnailURL = &assetURL
+	video, err = cfg.db.ReviseVideoThumbnail(r.Context(), video, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to update video's thumbnail URL", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, video)
+}
+
+// saveThumbnail writes an uploaded image to a randomly named file under the
+// assets root and returns the URL it is served from.
+func (cfg *apiConfig) saveThumbnail(file io.Reader, mediaType string) (string, error) {
 	// Get paths for the asset
 	rndm := make([]byte, 32)
-	_, err = rand.Read(rndm)
+	_, err := rand.Read(rndm)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "error reading from crypto/rand", err)
-		return
+		return "", err
 	}
 	rndmString := base64.RawURLEncoding.EncodeToString(rndm)
 	assetPath := getAssetPath(rndmString, mediaType)
 	if assetPath == "" {
-		respondWithError(w, http.StatusBadRequest, "Invalid media type", nil)
-		return
+		return "", fmt.Errorf("invalid media type %q", mediaType)
 	}
 
-	diskPath := cfg.getAssetDiskPath(assetPath)
-	assetURL := cfg.getAssetURL(assetPath)
-
 	// create a new file and copy the media to it
-	dst, err := os.Create(diskPath)
+	dst, err := os.Create(cfg.getAssetDiskPath(assetPath))
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Unable to create file at diskPath", err)
-		return
+		return "", err
 	}
 	defer dst.Close()
 
 	_, err = io.Copy(dst, file)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Unable to copy media to file", err)
-		return
-	}
-
-	// Update video metadata for new thumbnail URL
-	video.ThumbnailURL = &assetURL
-	err = cfg.db.UpdateVideo(video)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Unable to update video's thumbnail URL", err)
-		return
+		return "", err
 	}
 
-	respondWithJSON(w, http.StatusOK, video)
+	return cfg.getAssetURL(assetPath), nil
 }
 
 func getAssetPath(rndmString string, mediaType string) string {
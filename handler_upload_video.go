@@ -1,22 +1,27 @@
 package main
 
 import (
-	"crypto/rand"
-	"encoding/base64"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"mime"
 	"net/http"
 	"os"
 	"os/exec"
-	"strings"
 
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
 	"github.com/google/uuid"
 )
 
 func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		database.Video
+		Duplicates []duplicateMatch `json:"duplicates,omitempty"`
+	}
+
 	// Set upload limit
 	r.Body = http.MaxBytesReader(w, r.Body, 1<<30)
 
@@ -35,16 +40,20 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	userID, err := cfg.validateJWT(r.Context(), token)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
 		return
 	}
 
 	// Get video metadata
-	video, err := cfg.db.GetVideo(videoID)
+	video, err := cfg.db.GetVideo(r.Context(), videoID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Couldn't find video", err)
+		return
+	}
 	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Unable to find video", err)
+		respondWithError(w, http.StatusInternalServerError, "Unable to get video", err)
 		return
 	}
 	if video.UserID != userID {
@@ -81,7 +90,9 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 	defer os.Remove(tempFile.Name())
 	defer tempFile.Close()
 
-	_, err = io.Copy(tempFile, file)
+	// Hash the upload while it is written to disk
+	hasher := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tempFile, hasher), file)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Unable to copy media to file", err)
 		return
@@ -94,83 +105,116 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Process the video and open it
-	processedFile, err := processVideoForFastStart(tempFile.Name())
+	// Mark the video as processing until it is published, putting the old
+	// status back if the upload is abandoned
+	err = cfg.db.SetVideoProcessingStatus(r.Context(), videoID, database.ProcessingStatusProcessing)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Unable to process video file", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update video", err)
 		return
 	}
-	processed, err := os.Open(processedFile)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Unable to open processed video", err)
-		return
-	}
-	defer processed.Close()
-	defer os.Remove(processedFile)
+	published := false
+	restoreStatus := video.ProcessingStatus
+	defer func() {
+		if !published {
+			cfg.setProcessingStatus(r.Context(), videoID, restoreStatus)
+		}
+	}()
 
-	// Get aspect ratio
-	ratio, err := getVideoAspectRatio(processedFile)
+	// Process the video
+	processed, err := processVideoFile(tempFile.Name())
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "error determining aspect ratio", err)
+		restoreStatus = database.ProcessingStatusFailed
+		respondWithError(w, http.StatusInternalServerError, "Unable to process video file", err)
 		return
 	}
-	ratioKey := "other"
-	if ratio == "16:9" {
-		ratioKey = "landscape"
-	} else if ratio == "9:16" {
-		ratioKey = "portrait"
-	}
+	defer os.Remove(processed.path)
 
-	// Create random 32 byte hex and add media extension and ratio prefix for file key
-	rndm := make([]byte, 32)
-	_, err = rand.Read(rndm)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "error reading from crypto/rand", err)
-		return
+	// Look for earlier uploads of the same content
+	fingerprint := database.Fingerprint{
+		VideoID:     videoID,
+		UserID:      userID,
+		ContentHash: hex.EncodeToString(hasher.Sum(nil)),
+		FrameHashes: processed.frameHashes,
+		Duration:    processed.duration,
+	}
+	duplicates := []duplicateMatch{}
+	if cfg.duplicatePolicy != duplicatePolicyOff {
+		duplicates, err = cfg.findDuplicates(r.Context(), fingerprint)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't check for duplicate uploads", err)
+			return
+		}
 	}
-	rndmString := base64.RawURLEncoding.EncodeToString(rndm)
-	index := strings.LastIndex(mediaType, "/")
-	if index == -1 {
-		respondWithError(w, http.StatusBadRequest, "Invalid media type", nil)
+	if len(duplicates) > 0 && cfg.duplicatePolicy == duplicatePolicyBlock {
+		msg := "Video duplicates another user's video"
+		if duplicates[0].VideoID != nil {
+			msg = fmt.Sprintf("Video duplicates existing video %s", *duplicates[0].VideoID)
+		}
+		respondWithError(w, http.StatusConflict, msg, nil)
 		return
 	}
-	ext := mediaType[index+1:]
-	keyString := fmt.Sprintf(
-		"%s/%s.%s",
-		ratioKey,
-		rndmString,
-		ext,
-	)
 
-	// Put the object into the S3 Bucket
-	_, err = cfg.s3Client.PutObject(
-		r.Context(),
-		&s3.PutObjectInput{
-			Bucket:      &cfg.s3Bucket,
-			Key:         &keyString,
-			Body:        processed,
-			ContentType: &mediaType,
-		},
-	)
+	// Keep the original upload so the video can be re-processed later
+	originalKey, err := cfg.archiveOriginal(r.Context(), tempFile)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to archive original upload", err)
+		return
+	}
+	video.OriginalKey = &originalKey
+
+	// Suggest chapters from scene changes when asked to and none exist yet
+	if r.FormValue("detect_chapters") == "true" {
+		existing, err := cfg.db.GetChapters(r.Context(), videoID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get chapters", err)
+			return
+		}
+		if len(existing) == 0 {
+			suggested, err := detectSceneChapters(processed.path)
+			if err != nil {
+				respondWithError(w, http.StatusInternalServerError, "error detecting scene changes", err)
+				return
+			}
+			_, err = cfg.db.ReplaceChapters(r.Context(), videoID, suggested)
+			if err != nil {
+				respondWithError(w, http.StatusInternalServerError, "Couldn't save chapters", err)
+				return
+			}
+		}
+	}
+
+	// Extract an audio-only rendition for podcast feeds when asked to. The
+	// previous upload's rendition doesn't match the new video, so it is
+	// dropped otherwise.
+	if r.FormValue("extract_audio") == "true" {
+		err = cfg.attachAudioRendition(r.Context(), &video, tempFile.Name())
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Unable to create audio rendition", err)
+			return
+		}
+	} else {
+		video.AudioURL = nil
+		video.AudioDuration = nil
+	}
+
+	// Put the processed video into the S3 Bucket and update the video
+	err = cfg.publishProcessedVideo(r.Context(), &video, processed, userID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Unable to upload video", err)
 		return
 	}
+	published = true
 
-	// Update video url in database
-	videoURL := fmt.Sprintf(
-		"%s/%s",
-		cfg.s3CfDistribution,
-		keyString,
-	)
-	video.VideoURL = &videoURL
-	err = cfg.db.UpdateVideo(video)
+	err = cfg.db.SaveFingerprint(r.Context(), fingerprint)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Unable to update video URL", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save video fingerprint", err)
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, video)
+	respondWithJSON(w, http.StatusOK, response{
+		Video:      video,
+		Duplicates: duplicates,
+	})
 }
 
 func processVideoForFastStart(filePath string) (string, error) {
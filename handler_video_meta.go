@@ -3,16 +3,27 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math"
 	"net/http"
+	"net/url"
 	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
 	"github.com/google/uuid"
 )
 
+const (
+	maxVideoTitleLength       = 100
+	maxVideoDescriptionLength = 5000
+)
+
 func (cfg *apiConfig) handlerVideoMetaCreate(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
 		database.CreateVideoParams
@@ -23,7 +34,7 @@ func (cfg *apiConfig) handlerVideoMetaCreate(w http.ResponseWriter, r *http.Requ
 		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
 		return
 	}
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	userID, err := cfg.validateJWT(r.Context(), token)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
 		return
@@ -38,7 +49,36 @@ func (cfg *apiConfig) handlerVideoMetaCreate(w http.ResponseWriter, r *http.Requ
 	}
 	params.UserID = userID
 
-	video, err := cfg.db.CreateVideo(params.CreateVideoParams)
+	err = validateVideoMetadata(params.Title, params.Description)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	if params.Visibility == "" {
+		params.Visibility = database.VisibilityPrivate
+	}
+	err = validateVisibility(params.Visibility)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	if params.PublishAt != nil {
+		if !params.PublishAt.After(time.Now()) {
+			respondWithError(w, http.StatusBadRequest, "publish_at must be in the future", nil)
+			return
+		}
+		// Scheduled videos stay hidden until the scheduler publishes them
+		params.Visibility = database.VisibilityPrivate
+	}
+
+	params.Tags, err = normalizeTags(params.Tags)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	video, err := cfg.db.CreateVideo(r.Context(), params.CreateVideoParams)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't create video", err)
 		return
@@ -60,15 +100,19 @@ func (cfg *apiConfig) handlerVideoMetaDelete(w http.ResponseWriter, r *http.Requ
 		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
 		return
 	}
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	userID, err := cfg.validateJWT(r.Context(), token)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
 		return
 	}
 
-	video, err := cfg.db.GetVideo(videoID)
+	video, err := cfg.db.GetVideo(r.Context(), videoID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Couldn't find video", err)
+		return
+	}
 	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
 		return
 	}
 	if video.UserID != userID {
@@ -76,7 +120,11 @@ func (cfg *apiConfig) handlerVideoMetaDelete(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	err = cfg.db.DeleteVideo(videoID)
+	err = cfg.db.TrashVideo(r.Context(), videoID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Couldn't find video", err)
+		return
+	}
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't delete video", err)
 		return
@@ -86,41 +134,510 @@ func (cfg *apiConfig) handlerVideoMetaDelete(w http.ResponseWriter, r *http.Requ
 }
 
 func (cfg *apiConfig) handlerVideoGet(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		database.Video
+		Captions []database.Caption `json:"captions"`
+		Chapters []database.Chapter `json:"chapters"`
+		// MyReaction is the caller's reaction, nil when they haven't
+		// reacted or aren't logged in.
+		MyReaction *string `json:"my_reaction"`
+	}
+
+	video, ok := cfg.getVisibleVideo(w, r)
+	if !ok {
+		return
+	}
+
+	captions, err := cfg.db.GetCaptions(r.Context(), video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get captions", err)
+		return
+	}
+
+	chapters, err := cfg.db.GetChapters(r.Context(), video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get chapters", err)
+		return
+	}
+
+	// getVisibleVideo has already rejected invalid tokens.
+	userID, _ := cfg.optionalUserID(r)
+	myReaction, err := cfg.getMyReaction(r, video.ID, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get reaction", err)
+		return
+	}
+
+	w.Header().Set("ETag", videoETag(video))
+	respondWithJSON(w, http.StatusOK, response{
+		Video:      video,
+		Captions:   captions,
+		Chapters:   chapters,
+		MyReaction: myReaction,
+	})
+}
+
+// handlerVideoMetaUpdate edits a video's title and description. Fields left
+// out of the body are unchanged. Sending the ETag from GET as If-Match, or
+// the video's version in the body, makes the edit fail with 412 if the
+// video changed in the meantime.
+func (cfg *apiConfig) handlerVideoMetaUpdate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Title       *string `json:"title"`
+		Description *string `json:"description"`
+		Version     *int    `json:"version"`
+	}
+
 	videoIDString := r.PathValue("videoID")
 	videoID, err := uuid.Parse(videoIDString)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
 		return
 	}
 
-	video, err := cfg.db.GetVideo(videoID)
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := cfg.validateJWT(r.Context(), token)
 	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
 		return
 	}
 
+	video, err := cfg.db.GetVideo(r.Context(), videoID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Couldn't find video", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You can't edit this video", nil)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	update := database.UpdateVideoMetadataParams{
+		Title:       params.Title,
+		Description: params.Description,
+		UserID:      userID,
+		IfVersion:   params.Version,
+	}
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && ifMatch != "*" {
+		version, err := parseVideoETag(ifMatch)
+		if err != nil {
+			respondWithError(w, http.StatusPreconditionFailed, "If-Match doesn't match the video", err)
+			return
+		}
+		update.IfVersion = &version
+	}
+
+	title, description := video.Title, video.Description
+	if params.Title != nil {
+		title = *params.Title
+	}
+	if params.Description != nil {
+		description = *params.Description
+	}
+	err = validateVideoMetadata(title, description)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	video, err = cfg.db.UpdateVideoMetadata(r.Context(), videoID, update)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Couldn't find video", err)
+		return
+	}
+	if errors.Is(err, database.ErrModified) {
+		respondWithError(w, http.StatusPreconditionFailed, "Video was changed since it was loaded", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update video", err)
+		return
+	}
+
+	w.Header().Set("ETag", videoETag(video))
 	respondWithJSON(w, http.StatusOK, video)
 }
 
+func validateVideoMetadata(title, description string) error {
+	if strings.TrimSpace(title) == "" {
+		return errors.New("Video needs a title")
+	}
+	if utf8.RuneCountInString(title) > maxVideoTitleLength {
+		return fmt.Errorf("Video title is longer than %d characters", maxVideoTitleLength)
+	}
+	if utf8.RuneCountInString(description) > maxVideoDescriptionLength {
+		return fmt.Errorf("Video description is longer than %d characters", maxVideoDescriptionLength)
+	}
+	return nil
+}
+
+// videoETag identifies a version of a video by its version number, which
+// goes up on every write.
+func videoETag(video database.Video) string {
+	return `"` + strconv.Itoa(video.Version) + `"`
+}
+
+func parseVideoETag(etag string) (int, error) {
+	etag = strings.TrimPrefix(strings.TrimSpace(etag), "W/")
+	version, err := strconv.Atoi(strings.Trim(etag, `"`))
+	if err != nil {
+		return 0, fmt.Errorf("invalid ETag %q", etag)
+	}
+	return version, nil
+}
+
 func (cfg *apiConfig) handlerVideosRetrieve(w http.ResponseWriter, r *http.Request) {
 	token, err := auth.GetBearerToken(r.Header)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
 		return
 	}
-	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	userID, err := cfg.validateJWT(r.Context(), token)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
 		return
 	}
 
-	videos, err := cfg.db.GetVideos(userID)
+	params, err := parseGetVideosParams(r.URL.Query())
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	params.UserID = userID
+	err = params.Validate()
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	page, err := cfg.db.GetVideos(r.Context(), params)
+	if errors.Is(err, database.ErrInvalidCursor) {
+		respondWithError(w, http.StatusBadRequest, "Invalid cursor", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve videos", err)
+		return
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(page.Total))
+	if page.NextCursor != "" {
+		w.Header().Set("X-Next-Cursor", page.NextCursor)
+	}
+	respondWithJSON(w, http.StatusOK, page.Videos)
+}
+
+// handlerPublicVideosRetrieve lists public videos without authentication,
+// optionally narrowed to one creator with user_id. It takes the same
+// pagination and filter parameters as handlerVideosRetrieve.
+func (cfg *apiConfig) handlerPublicVideosRetrieve(w http.ResponseWriter, r *http.Request) {
+	params, err := parseGetVideosParams(r.URL.Query())
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	params.Visibility = database.VisibilityPublic
+	if userID := r.URL.Query().Get("user_id"); userID != "" {
+		params.UserID, err = uuid.Parse(userID)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid user ID", err)
+			return
+		}
+	}
+	err = params.Validate()
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	page, err := cfg.db.GetVideos(r.Context(), params)
+	if errors.Is(err, database.ErrInvalidCursor) {
+		respondWithError(w, http.StatusBadRequest, "Invalid cursor", err)
+		return
+	}
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve videos", err)
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, videos)
+	w.Header().Set("X-Total-Count", strconv.Itoa(page.Total))
+	if page.NextCursor != "" {
+		w.Header().Set("X-Next-Cursor", page.NextCursor)
+	}
+	respondWithJSON(w, http.StatusOK, page.Videos)
+}
+
+func (cfg *apiConfig) handlerVideoVisibilityUpdate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Visibility string `json:"visibility"`
+	}
+
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := cfg.validateJWT(r.Context(), token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(r.Context(), videoID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Couldn't find video", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You can't change this video's visibility", nil)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	err = validateVisibility(params.Visibility)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	update := database.UpdateVideoVisibilityParams{
+		Visibility: params.Visibility,
+		UserID:     userID,
+		// The kept schedule is the one read above, so the write only goes
+		// through if nothing changed in between
+		IfVersion: &video.Version,
+	}
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && ifMatch != "*" {
+		version, err := parseVideoETag(ifMatch)
+		if err != nil {
+			respondWithError(w, http.StatusPreconditionFailed, "If-Match doesn't match the video", err)
+			return
+		}
+		update.IfVersion = &version
+	}
+	if params.Visibility == database.VisibilityPrivate {
+		// Publishing by hand replaces any pending schedule, staying
+		// private keeps it
+		update.PublishAt = video.PublishAt
+	}
+
+	video, err = cfg.db.UpdateVideoVisibility(r.Context(), videoID, update)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Couldn't find video", err)
+		return
+	}
+	if errors.Is(err, database.ErrModified) {
+		respondWithError(w, http.StatusPreconditionFailed, "Video was changed since it was loaded", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update video", err)
+		return
+	}
+
+	w.Header().Set("ETag", videoETag(video))
+	respondWithJSON(w, http.StatusOK, video)
+}
+
+// handlerVideoScheduleUpdate sets or clears the time at which a video is
+// made public. Scheduling a video makes it private until then.
+func (cfg *apiConfig) handlerVideoScheduleUpdate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		PublishAt *time.Time `json:"publish_at"`
+	}
+
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := cfg.validateJWT(r.Context(), token)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(r.Context(), videoID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Couldn't find video", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You can't schedule this video", nil)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	update := database.UpdateVideoVisibilityParams{
+		Visibility: video.Visibility,
+		PublishAt:  params.PublishAt,
+		UserID:     userID,
+		// The kept visibility is the one read above, so the write only goes
+		// through if nothing changed in between
+		IfVersion: &video.Version,
+	}
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" && ifMatch != "*" {
+		version, err := parseVideoETag(ifMatch)
+		if err != nil {
+			respondWithError(w, http.StatusPreconditionFailed, "If-Match doesn't match the video", err)
+			return
+		}
+		update.IfVersion = &version
+	}
+	if params.PublishAt != nil {
+		if !params.PublishAt.After(time.Now()) {
+			respondWithError(w, http.StatusBadRequest, "publish_at must be in the future", nil)
+			return
+		}
+		update.Visibility = database.VisibilityPrivate
+	}
+
+	video, err = cfg.db.UpdateVideoVisibility(r.Context(), videoID, update)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Couldn't find video", err)
+		return
+	}
+	if errors.Is(err, database.ErrModified) {
+		respondWithError(w, http.StatusPreconditionFailed, "Video was changed since it was loaded", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update video", err)
+		return
+	}
+
+	w.Header().Set("ETag", videoETag(video))
+	respondWithJSON(w, http.StatusOK, video)
+}
+
+// parseGetVideosParams reads the listing options from the query string:
+// limit, cursor, sort (created_at, updated_at or title), order (asc or
+// desc), has_video, has_thumbnail, aspect_ratio, processing_status, tag,
+// created_after and created_before (RFC 3339).
+func parseGetVideosParams(query url.Values) (database.GetVideosParams, error) {
+	params := database.GetVideosParams{
+		Cursor:           query.Get("cursor"),
+		Sort:             database.VideoSort(query.Get("sort")),
+		AspectRatio:      query.Get("aspect_ratio"),
+		ProcessingStatus: query.Get("processing_status"),
+		Tag:              normalizeTag(query.Get("tag")),
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > database.MaxVideoPageSize {
+			return params, fmt.Errorf("limit must be between 1 and %d", database.MaxVideoPageSize)
+		}
+		params.Limit = n
+	}
+
+	if params.Sort == "" {
+		params.Sort = database.VideoSortCreatedAt
+	}
+	switch query.Get("order") {
+	case "asc":
+	case "desc":
+		params.Descending = true
+	case "":
+		// Newest first for timestamps, alphabetical for titles
+		params.Descending = params.Sort != database.VideoSortTitle
+	default:
+		return params, errors.New("order must be asc or desc")
+	}
+
+	var err error
+	params.HasVideo, err = parseOptionalBool(query, "has_video")
+	if err != nil {
+		return params, err
+	}
+	params.HasThumbnail, err = parseOptionalBool(query, "has_thumbnail")
+	if err != nil {
+		return params, err
+	}
+	params.CreatedAfter, err = parseOptionalTime(query, "created_after")
+	if err != nil {
+		return params, err
+	}
+	params.CreatedBefore, err = parseOptionalTime(query, "created_before")
+	if err != nil {
+		return params, err
+	}
+
+	return params, nil
+}
+
+func parseOptionalBool(query url.Values, key string) (*bool, error) {
+	value := query.Get(key)
+	if value == "" {
+		return nil, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be true or false", key)
+	}
+	return &b, nil
+}
+
+func parseOptionalTime(query url.Values, key string) (*time.Time, error) {
+	value := query.Get(key)
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an RFC 3339 timestamp", key)
+	}
+	return &t, nil
 }
 
 func getVideoAspectRatio(filePath string) (string, error) {
@@ -169,6 +686,42 @@ func getVideoAspectRatio(filePath string) (string, error) {
 	return ratio, nil
 }
 
+func getMediaDuration(filePath string) (float64, error) {
+	// Set the command
+	cmd := exec.Command(
+		"ffprobe",
+		"-v",
+		"error",
+		"-print_format",
+		"json",
+		"-show_format",
+		filePath,
+	)
+
+	// Run the command
+	var b bytes.Buffer
+	cmd.Stdout = &b
+	err := cmd.Run()
+	if err != nil {
+		return 0, err
+	}
+
+	// Json parameters, ffprobe reports the duration as a string
+	type parameters struct {
+		Format struct {
+			Duration string `json:"duration"`
+		} `json:"format"`
+	}
+
+	params := parameters{}
+	err = json.Unmarshal(b.Bytes(), &params)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseFloat(params.Format.Duration, 64)
+}
+
 func determineRatio(width, height int) string {
 	const tol = 100
 
@@ -0,0 +1,747 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database/memstore"
+	"github.com/google/uuid"
+)
+
+const (
+	testBucket   = "tubely-test"
+	testAdminKey = "admin-key"
+	testPassword = "hunter2"
+)
+
+// testServer serves the API over an in-process handler, with S3 replaced by
+// an in-memory fake.
+type testServer struct {
+	cfg     *apiConfig
+	handler http.Handler
+	s3      *fakeS3
+}
+
+// forEachStore runs test against the in-memory store and a freshly migrated
+// SQLite database, so the two can't drift apart.
+func forEachStore(t *testing.T, test func(t *testing.T, s *testServer)) {
+	t.Run("memstore", func(t *testing.T) {
+		test(t, newTestServer(t, memstore.New()))
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		test(t, newTestServer(t, newSQLiteStore(t)))
+	})
+}
+
+func newSQLiteStore(t *testing.T) database.Client {
+	t.Helper()
+	db, err := database.NewClient(filepath.Join(t.TempDir(), "tubely.db"))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	if err := migrateUp(db); err != nil {
+		t.Fatalf("migrateUp() error = %v", err)
+	}
+	return db
+}
+
+func newTestServer(t *testing.T, db database.Store) *testServer {
+	t.Helper()
+	fake := &fakeS3{objects: map[string][]byte{}}
+	s3Server := httptest.NewServer(fake)
+	t.Cleanup(s3Server.Close)
+
+	filepathRoot := t.TempDir()
+	err := os.WriteFile(filepath.Join(filepathRoot, "index.html"), []byte("<h1>Tubely</h1>"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &apiConfig{
+		db:               db,
+		jwtSecret:        "test-secret",
+		platform:         "dev",
+		filepathRoot:     filepathRoot,
+		assetsRoot:       t.TempDir(),
+		s3Bucket:         testBucket,
+		s3Region:         "us-east-1",
+		s3CfDistribution: "https://cdn.example.com",
+		s3Client: s3.New(s3.Options{
+			Region:       "us-east-1",
+			BaseEndpoint: &s3Server.URL,
+			UsePathStyle: true,
+		}),
+		port:            "8091",
+		duplicatePolicy: duplicatePolicyWarn,
+		duplicateScope:  duplicateScopeUser,
+
+		adminAPIKey:          testAdminKey,
+		audioFormat:          "aac",
+		trashRetention:       30 * 24 * time.Hour,
+		accessTokenTTL:       15 * time.Minute,
+		refreshTokenTTL:      60 * 24 * time.Hour,
+		playbackEventLimiter: newRateLimiter(time.Minute, maxPlaybackEventsPerMinute),
+	}
+	return &testServer{cfg: cfg, handler: cfg.routes(), s3: fake}
+}
+
+// fakeS3 keeps objects in memory and answers the path-style PutObject,
+// GetObject and DeleteObject requests the handlers make.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key, ok := strings.CutPrefix(r.URL.Path, "/"+testBucket+"/")
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.objects[key] = data
+	case http.MethodGet:
+		data, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeS3) keys() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	keys := []string{}
+	for key := range f.objects {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// send serves req and fails the test unless the response has the wanted
+// status.
+func (s *testServer) send(t *testing.T, req *http.Request, want int) *http.Response {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	s.handler.ServeHTTP(rec, req)
+	resp := rec.Result()
+	if resp.StatusCode != want {
+		t.Fatalf("%s %s = %d %s, want %d", req.Method, req.URL.Path, resp.StatusCode, strings.TrimSpace(rec.Body.String()), want)
+	}
+	return resp
+}
+
+// request sends body as JSON, with token as the bearer token unless empty.
+func (s *testServer) request(t *testing.T, method, path, token string, body any, want int) *http.Response {
+	t.Helper()
+	return s.send(t, newRequest(t, method, path, token, body), want)
+}
+
+func newRequest(t *testing.T, method, path, token string, body any) *http.Request {
+	t.Helper()
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, path, r)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req
+}
+
+// upload posts a multipart form with one file in field, plus any extra
+// form values.
+func (s *testServer) upload(t *testing.T, path, token, field, filename, contentType string, data []byte, values map[string]string, want int) *http.Response {
+	t.Helper()
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	for name, value := range values {
+		if err := mw.WriteField(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name=%q; filename=%q`, field, filename))
+	header.Set("Content-Type", contentType)
+	part, err := mw.CreatePart(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(data)
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, path, body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return s.send(t, req, want)
+}
+
+func decodeBody[T any](t *testing.T, resp *http.Response) T {
+	t.Helper()
+	var v T
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		t.Fatalf("couldn't decode response: %v", err)
+	}
+	return v
+}
+
+type loginResponse struct {
+	database.User
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// signUp creates a user and logs them in.
+func (s *testServer) signUp(t *testing.T) loginResponse {
+	t.Helper()
+	params := map[string]string{"email": uuid.NewString() + "@example.com", "password": testPassword}
+	s.request(t, http.MethodPost, "/api/users", "", params, http.StatusCreated)
+	return s.login(t, params["email"], testPassword)
+}
+
+func (s *testServer) login(t *testing.T, email, password string) loginResponse {
+	t.Helper()
+	params := map[string]string{"email": email, "password": password}
+	return decodeBody[loginResponse](t, s.request(t, http.MethodPost, "/api/login", "", params, http.StatusOK))
+}
+
+func (s *testServer) createVideo(t *testing.T, token string, params map[string]any) database.Video {
+	t.Helper()
+	return decodeBody[database.Video](t, s.request(t, http.MethodPost, "/api/videos", token, params, http.StatusCreated))
+}
+
+// pngPixel is a 1x1 PNG.
+var pngPixel = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x06\x00\x00\x00\x1f\x15\xc4\x89\x00\x00\x00\rIDATx\x9cc\xf8\x0f\x00\x00\x01\x01\x00\x05\x18\xd8N\x00\x00\x00\x00IEND\xaeB`\x82")
+
+func TestRoutesRequireAuth(t *testing.T) {
+	s := newTestServer(t, memstore.New())
+	id := uuid.NewString()
+	routes := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodGet, "/api/sessions"},
+		{http.MethodDelete, "/api/sessions"},
+		{http.MethodDelete, "/api/sessions/" + id},
+		{http.MethodPut, "/api/users/password"},
+		{http.MethodPost, "/api/videos"},
+		{http.MethodPost, "/api/thumbnail_upload/" + id},
+		{http.MethodPost, "/api/video_upload/" + id},
+		{http.MethodGet, "/api/videos"},
+		{http.MethodGet, "/api/videos/search?q=go"},
+		{http.MethodGet, "/api/videos/trash"},
+		{http.MethodPatch, "/api/videos/" + id},
+		{http.MethodPut, "/api/videos/" + id + "/visibility"},
+		{http.MethodPut, "/api/videos/" + id + "/schedule"},
+		{http.MethodPost, "/api/videos/" + id + "/captions"},
+		{http.MethodDelete, "/api/videos/" + id + "/captions/en"},
+		{http.MethodPut, "/api/videos/" + id + "/tags"},
+		{http.MethodGet, "/api/tags"},
+		{http.MethodPut, "/api/videos/" + id + "/chapters"},
+		{http.MethodDelete, "/api/videos/" + id},
+		{http.MethodPost, "/api/videos/" + id + "/restore"},
+		{http.MethodGet, "/api/videos/" + id + "/revisions"},
+		{http.MethodGet, "/api/videos/" + id + "/analytics"},
+		{http.MethodPut, "/api/videos/" + id + "/reaction"},
+		{http.MethodDelete, "/api/videos/" + id + "/reaction"},
+		{http.MethodPost, "/api/videos/" + id + "/comments"},
+		{http.MethodPatch, "/api/videos/" + id + "/comments/" + id},
+		{http.MethodDelete, "/api/videos/" + id + "/comments/" + id},
+		{http.MethodPut, "/api/videos/" + id + "/comments/" + id + "/pin"},
+		{http.MethodPut, "/api/videos/" + id + "/comment_settings"},
+		{http.MethodPost, "/api/videos/" + id + "/revisions/" + id + "/rollback"},
+		{http.MethodPost, "/api/playlists"},
+		{http.MethodGet, "/api/playlists"},
+		{http.MethodPut, "/api/playlists/" + id},
+		{http.MethodDelete, "/api/playlists/" + id},
+		{http.MethodPost, "/api/playlists/" + id + "/thumbnail"},
+		{http.MethodPost, "/api/playlists/" + id + "/items"},
+		{http.MethodPut, "/api/playlists/" + id + "/items"},
+		{http.MethodPatch, "/api/playlists/" + id + "/items/" + id},
+		{http.MethodDelete, "/api/playlists/" + id + "/items/" + id},
+		{http.MethodPost, "/admin/videos/reprocess"},
+		{http.MethodPost, "/admin/videos/" + id + "/reprocess"},
+	}
+	for _, route := range routes {
+		t.Run(route.method+" "+route.path, func(t *testing.T) {
+			s.request(t, route.method, route.path, "", nil, http.StatusUnauthorized)
+		})
+	}
+}
+
+func TestStaticRoutes(t *testing.T) {
+	s := newTestServer(t, memstore.New())
+	resp := s.request(t, http.MethodGet, "/app/", "", nil, http.StatusOK)
+	if body, _ := io.ReadAll(resp.Body); !strings.Contains(string(body), "Tubely") {
+		t.Errorf("GET /app/ = %q, want the index page", body)
+	}
+
+	err := os.WriteFile(filepath.Join(s.cfg.assetsRoot, "thumb.png"), pngPixel, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp = s.request(t, http.MethodGet, "/assets/thumb.png", "", nil, http.StatusOK)
+	if got := resp.Header.Get("Cache-Control"); got != "no-store" {
+		t.Errorf("GET /assets/ Cache-Control = %q, want no-store", got)
+	}
+}
+
+func TestAuthRoutes(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *testServer) {
+		user := s.signUp(t)
+		s.request(t, http.MethodPost, "/api/users", "", map[string]string{"email": user.Email, "password": testPassword}, http.StatusConflict)
+		s.request(t, http.MethodPost, "/api/login", "", map[string]string{"email": user.Email, "password": "wrong"}, http.StatusUnauthorized)
+		second := s.login(t, user.Email, testPassword)
+
+		sessions := decodeBody[[]database.Session](t, s.request(t, http.MethodGet, "/api/sessions", user.Token, nil, http.StatusOK))
+		if len(sessions) != 2 {
+			t.Fatalf("GET /api/sessions = %d sessions, want 2", len(sessions))
+		}
+
+		refreshed := decodeBody[loginResponse](t, s.request(t, http.MethodPost, "/api/refresh", user.RefreshToken, nil, http.StatusOK))
+		s.request(t, http.MethodGet, "/api/videos", refreshed.Token, nil, http.StatusOK)
+		// Presenting a rotated refresh token again logs that session out.
+		s.request(t, http.MethodPost, "/api/refresh", user.RefreshToken, nil, http.StatusUnauthorized)
+		s.request(t, http.MethodPost, "/api/refresh", refreshed.RefreshToken, nil, http.StatusUnauthorized)
+
+		s.request(t, http.MethodPost, "/api/revoke", second.RefreshToken, nil, http.StatusNoContent)
+		s.request(t, http.MethodPost, "/api/refresh", second.RefreshToken, nil, http.StatusUnauthorized)
+
+		third := s.login(t, user.Email, testPassword)
+		sessions = decodeBody[[]database.Session](t, s.request(t, http.MethodGet, "/api/sessions", third.Token, nil, http.StatusOK))
+		if len(sessions) != 1 {
+			t.Fatalf("GET /api/sessions = %d sessions, want 1", len(sessions))
+		}
+		s.request(t, http.MethodDelete, "/api/sessions/"+uuid.NewString(), third.Token, nil, http.StatusNotFound)
+		s.request(t, http.MethodDelete, "/api/sessions/"+sessions[0].ID.String(), third.Token, nil, http.StatusNoContent)
+		s.request(t, http.MethodPost, "/api/refresh", third.RefreshToken, nil, http.StatusUnauthorized)
+
+		s.login(t, user.Email, testPassword)
+		s.request(t, http.MethodDelete, "/api/sessions", third.Token, nil, http.StatusNoContent)
+		sessions = decodeBody[[]database.Session](t, s.request(t, http.MethodGet, "/api/sessions", third.Token, nil, http.StatusOK))
+		if len(sessions) != 0 {
+			t.Errorf("GET /api/sessions after DELETE = %d sessions, want none", len(sessions))
+		}
+
+		password := map[string]string{"current_password": "wrong", "new_password": "new"}
+		s.request(t, http.MethodPut, "/api/users/password", third.Token, password, http.StatusUnauthorized)
+		password["current_password"] = testPassword
+		s.request(t, http.MethodPut, "/api/users/password", third.Token, password, http.StatusNoContent)
+		// Access tokens issued before the change stop working.
+		s.request(t, http.MethodGet, "/api/videos", third.Token, nil, http.StatusUnauthorized)
+		s.login(t, user.Email, "new")
+	})
+}
+
+func TestVideoRoutes(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *testServer) {
+		owner := s.signUp(t)
+		other := s.signUp(t)
+		s.request(t, http.MethodPost, "/api/videos", owner.Token, map[string]any{"title": " "}, http.StatusBadRequest)
+		s.request(t, http.MethodPost, "/api/videos", owner.Token, map[string]any{"title": strings.Repeat("a", 101)}, http.StatusBadRequest)
+		video := s.createVideo(t, owner.Token, map[string]any{
+			"title":       "Concurrency patterns",
+			"description": "Goroutines and channels",
+			"tags":        []string{"Go"},
+		})
+		if video.Visibility != database.VisibilityPrivate {
+			t.Errorf("POST /api/videos visibility = %q, want %q", video.Visibility, database.VisibilityPrivate)
+		}
+		path := "/api/videos/" + video.ID.String()
+
+		s.request(t, http.MethodGet, path, other.Token, nil, http.StatusNotFound)
+		resp := s.request(t, http.MethodGet, path, owner.Token, nil, http.StatusOK)
+		etag := resp.Header.Get("ETag")
+		if etag == "" {
+			t.Fatalf("GET %s has no ETag", path)
+		}
+
+		s.request(t, http.MethodPatch, path, other.Token, map[string]string{"title": "Mine"}, http.StatusForbidden)
+		req := newRequest(t, http.MethodPatch, path, owner.Token, map[string]string{"title": "Concurrency in Go"})
+		req.Header.Set("If-Match", etag)
+		resp = s.send(t, req, http.StatusOK)
+		if resp.Header.Get("ETag") == etag {
+			t.Errorf("PATCH %s kept ETag %s", path, etag)
+		}
+		req = newRequest(t, http.MethodPatch, path, owner.Token, map[string]string{"title": "Stale"})
+		req.Header.Set("If-Match", etag)
+		s.send(t, req, http.StatusPreconditionFailed)
+		s.request(t, http.MethodPatch, path, owner.Token, map[string]string{"description": strings.Repeat("é", 5001)}, http.StatusBadRequest)
+		s.request(t, http.MethodPatch, path, owner.Token, map[string]string{"description": strings.Repeat("é", 5000)}, http.StatusOK)
+
+		publishAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+		scheduled := decodeBody[database.Video](t, s.request(t, http.MethodPut, path+"/schedule", owner.Token, map[string]any{"publish_at": publishAt}, http.StatusOK))
+		if scheduled.PublishAt == nil || !scheduled.PublishAt.Equal(publishAt) {
+			t.Errorf("PUT %s/schedule publish_at = %v, want %v", path, scheduled.PublishAt, publishAt)
+		}
+		s.request(t, http.MethodPut, path+"/schedule", owner.Token, map[string]any{"publish_at": time.Now().Add(-time.Hour)}, http.StatusBadRequest)
+		req = newRequest(t, http.MethodPut, path+"/schedule", owner.Token, map[string]any{"publish_at": nil})
+		req.Header.Set("If-Match", etag)
+		s.send(t, req, http.StatusPreconditionFailed)
+
+		s.request(t, http.MethodPut, path+"/visibility", owner.Token, map[string]string{"visibility": "everyone"}, http.StatusBadRequest)
+		req = newRequest(t, http.MethodPut, path+"/visibility", owner.Token, map[string]string{"visibility": database.VisibilityPublic})
+		req.Header.Set("If-Match", etag)
+		s.send(t, req, http.StatusPreconditionFailed)
+		public := decodeBody[database.Video](t, s.request(t, http.MethodPut, path+"/visibility", owner.Token, map[string]string{"visibility": database.VisibilityPublic}, http.StatusOK))
+		if public.Visibility != database.VisibilityPublic || public.PublishAt != nil {
+			t.Errorf("PUT %s/visibility = %s publish_at %v, want public and unscheduled", path, public.Visibility, public.PublishAt)
+		}
+		s.request(t, http.MethodGet, path, "", nil, http.StatusOK)
+
+		s.createVideo(t, owner.Token, map[string]any{"title": "Cooking pasta"})
+		resp = s.request(t, http.MethodGet, "/api/videos", owner.Token, nil, http.StatusOK)
+		if got := resp.Header.Get("X-Total-Count"); got != "2" {
+			t.Errorf("GET /api/videos X-Total-Count = %q, want 2", got)
+		}
+		resp = s.request(t, http.MethodGet, "/api/public/videos?user_id="+owner.ID.String(), "", nil, http.StatusOK)
+		if videos := decodeBody[[]database.Video](t, resp); len(videos) != 1 || videos[0].ID != video.ID {
+			t.Errorf("GET /api/public/videos = %d videos, want only the public one", len(videos))
+		}
+		s.request(t, http.MethodGet, "/api/public/videos?user_id=nope", "", nil, http.StatusBadRequest)
+
+		results := decodeBody[[]database.VideoSearchResult](t, s.request(t, http.MethodGet, "/api/videos/search?q=concurr", owner.Token, nil, http.StatusOK))
+		if len(results) != 1 || results[0].Video.ID != video.ID {
+			t.Errorf("GET /api/videos/search = %d results, want only %q", len(results), video.Title)
+		}
+		s.request(t, http.MethodGet, "/api/videos/search?q=+", owner.Token, nil, http.StatusBadRequest)
+	})
+}
+
+func TestVideoUploadRoutes(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *testServer) {
+		owner := s.signUp(t)
+		other := s.signUp(t)
+		video := s.createVideo(t, owner.Token, map[string]any{"title": "Uploaded"})
+		id := video.ID.String()
+
+		s.upload(t, "/api/thumbnail_upload/"+id, owner.Token, "thumbnail", "thumb.gif", "image/gif", pngPixel, nil, http.StatusBadRequest)
+		s.upload(t, "/api/thumbnail_upload/"+id, other.Token, "thumbnail", "thumb.png", "image/png", pngPixel, nil, http.StatusUnauthorized)
+		first := decodeBody[database.Video](t, s.upload(t, "/api/thumbnail_upload/"+id, owner.Token, "thumbnail", "thumb.png", "image/png", pngPixel, nil, http.StatusOK))
+		if first.ThumbnailURL == nil {
+			t.Fatal("POST /api/thumbnail_upload didn't set thumbnail_url")
+		}
+		assetPath := (*first.ThumbnailURL)[strings.Index(*first.ThumbnailURL, "/assets/"):]
+		s.request(t, http.MethodGet, assetPath, "", nil, http.StatusOK)
+		second := decodeBody[database.Video](t, s.upload(t, "/api/thumbnail_upload/"+id, owner.Token, "thumbnail", "thumb.jpg", "image/jpeg", pngPixel, nil, http.StatusOK))
+
+		s.request(t, http.MethodGet, "/api/videos/"+id+"/revisions", other.Token, nil, http.StatusForbidden)
+		revisions := decodeBody[[]database.VideoRevision](t, s.request(t, http.MethodGet, "/api/videos/"+id+"/revisions", owner.Token, nil, http.StatusOK))
+		if len(revisions) != 2 {
+			t.Fatalf("GET /api/videos/%s/revisions = %d revisions, want 2", id, len(revisions))
+		}
+		var firstRevision database.VideoRevision
+		for _, revision := range revisions {
+			if revision.Number == 1 {
+				firstRevision = revision
+			}
+		}
+		rolledBack := decodeBody[database.Video](t, s.request(t, http.MethodPost, "/api/videos/"+id+"/revisions/"+firstRevision.ID.String()+"/rollback", owner.Token, nil, http.StatusOK))
+		if rolledBack.ThumbnailURL == nil || *rolledBack.ThumbnailURL != *first.ThumbnailURL || *rolledBack.ThumbnailURL == *second.ThumbnailURL {
+			t.Errorf("rollback thumbnail_url = %v, want %s", rolledBack.ThumbnailURL, *first.ThumbnailURL)
+		}
+
+		// The success path needs ffmpeg, these are rejected before it runs.
+		s.upload(t, "/api/video_upload/"+id, other.Token, "video", "clip.mp4", "video/mp4", []byte("mp4"), nil, http.StatusUnauthorized)
+		s.upload(t, "/api/video_upload/"+id, owner.Token, "video", "clip.avi", "video/x-msvideo", []byte("avi"), nil, http.StatusBadRequest)
+		s.upload(t, "/api/video_upload/"+uuid.NewString(), owner.Token, "video", "clip.mp4", "video/mp4", []byte("mp4"), nil, http.StatusNotFound)
+	})
+}
+
+func TestCaptionRoutes(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *testServer) {
+		owner := s.signUp(t)
+		video := s.createVideo(t, owner.Token, map[string]any{"title": "Captioned"})
+		path := "/api/videos/" + video.ID.String() + "/captions"
+		srt := []byte("1\n00:00:01,000 --> 00:00:02,000\nHello\n")
+
+		s.upload(t, path, owner.Token, "caption", "en.srt", "application/x-subrip", srt, map[string]string{"language": "not a tag"}, http.StatusBadRequest)
+		s.upload(t, path, owner.Token, "caption", "en.srt", "application/x-subrip", []byte("nonsense"), map[string]string{"language": "en"}, http.StatusBadRequest)
+		caption := decodeBody[database.Caption](t, s.upload(t, path, owner.Token, "caption", "en.srt", "application/x-subrip", srt, map[string]string{"language": "en", "label": "English"}, http.StatusCreated))
+		if caption.Language != "en" || caption.Label != "English" {
+			t.Errorf("POST %s = %s %q, want en %q", path, caption.Language, caption.Label, "English")
+		}
+		if keys := s.s3.keys(); len(keys) != 1 || !strings.HasSuffix(keys[0], ".vtt") {
+			t.Errorf("uploaded objects = %v, want one WebVTT file", keys)
+		}
+
+		captionList := decodeBody[[]database.Caption](t, s.request(t, http.MethodGet, path, owner.Token, nil, http.StatusOK))
+		if len(captionList) != 1 {
+			t.Fatalf("GET %s = %d captions, want 1", path, len(captionList))
+		}
+		s.request(t, http.MethodGet, path, "", nil, http.StatusNotFound)
+		s.request(t, http.MethodDelete, path+"/en", owner.Token, nil, http.StatusNoContent)
+		captionList = decodeBody[[]database.Caption](t, s.request(t, http.MethodGet, path, owner.Token, nil, http.StatusOK))
+		if len(captionList) != 0 {
+			t.Errorf("GET %s after DELETE = %d captions, want none", path, len(captionList))
+		}
+	})
+}
+
+func TestTagAndChapterRoutes(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *testServer) {
+		owner := s.signUp(t)
+		video := s.createVideo(t, owner.Token, map[string]any{"title": "Tagged"})
+		path := "/api/videos/" + video.ID.String()
+
+		tags := decodeBody[struct {
+			Tags []string `json:"tags"`
+		}](t, s.request(t, http.MethodPut, path+"/tags", owner.Token, map[string]any{"tags": []string{"Go", "go", "Testing"}}, http.StatusOK))
+		if len(tags.Tags) != 2 {
+			t.Errorf("PUT %s/tags = %v, want the two distinct tags", path, tags.Tags)
+		}
+		counts := decodeBody[[]database.TagCount](t, s.request(t, http.MethodGet, "/api/tags?prefix=te", owner.Token, nil, http.StatusOK))
+		if len(counts) != 1 || counts[0].Count != 1 {
+			t.Errorf("GET /api/tags = %+v, want one tag used once", counts)
+		}
+
+		chapters := []database.CreateChapterParams{{Title: "Intro", StartTime: 0}, {Title: "Main", StartTime: 30}}
+		s.request(t, http.MethodPut, path+"/chapters", owner.Token, map[string]any{"chapters": []database.CreateChapterParams{chapters[1], chapters[0]}}, http.StatusBadRequest)
+		s.request(t, http.MethodPut, path+"/chapters", owner.Token, map[string]any{"chapters": chapters}, http.StatusOK)
+		got := decodeBody[[]database.Chapter](t, s.request(t, http.MethodGet, path+"/chapters", owner.Token, nil, http.StatusOK))
+		if len(got) != 2 || got[1].Title != "Main" {
+			t.Errorf("GET %s/chapters = %+v, want both chapters in order", path, got)
+		}
+		resp := s.request(t, http.MethodGet, path+"/chapters.vtt", owner.Token, nil, http.StatusOK)
+		body, _ := io.ReadAll(resp.Body)
+		if resp.Header.Get("Content-Type") != "text/vtt" || !strings.HasPrefix(string(body), "WEBVTT") {
+			t.Errorf("GET %s/chapters.vtt = %s %q, want a WebVTT file", path, resp.Header.Get("Content-Type"), body)
+		}
+	})
+}
+
+func TestTrashRoutes(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *testServer) {
+		owner := s.signUp(t)
+		other := s.signUp(t)
+		video := s.createVideo(t, owner.Token, map[string]any{"title": "Trashed"})
+		path := "/api/videos/" + video.ID.String()
+
+		s.request(t, http.MethodDelete, path, other.Token, nil, http.StatusForbidden)
+		s.request(t, http.MethodDelete, path, owner.Token, nil, http.StatusNoContent)
+		s.request(t, http.MethodGet, path, owner.Token, nil, http.StatusNotFound)
+		s.request(t, http.MethodDelete, path, owner.Token, nil, http.StatusNotFound)
+
+		trash := decodeBody[[]database.Video](t, s.request(t, http.MethodGet, "/api/videos/trash", owner.Token, nil, http.StatusOK))
+		if len(trash) != 1 || trash[0].ID != video.ID {
+			t.Fatalf("GET /api/videos/trash = %d videos, want the trashed one", len(trash))
+		}
+		s.request(t, http.MethodPost, path+"/restore", other.Token, nil, http.StatusForbidden)
+		s.request(t, http.MethodPost, path+"/restore", owner.Token, nil, http.StatusOK)
+		s.request(t, http.MethodGet, path, owner.Token, nil, http.StatusOK)
+	})
+}
+
+func TestAnalyticsAndReactionRoutes(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *testServer) {
+		owner := s.signUp(t)
+		viewer := s.signUp(t)
+		video := s.createVideo(t, owner.Token, map[string]any{"title": "Watched", "visibility": database.VisibilityPublic})
+		path := "/api/videos/" + video.ID.String()
+
+		s.cfg.playbackEventLimiter = newRateLimiter(time.Minute, 3)
+		s.request(t, http.MethodPost, path+"/events", "", map[string]any{"session_id": "one", "type": "seek"}, http.StatusBadRequest)
+		s.request(t, http.MethodPost, path+"/events", "", map[string]any{"session_id": "one", "type": "play"}, http.StatusNoContent)
+		s.request(t, http.MethodPost, path+"/events", "", map[string]any{"session_id": "one", "type": "progress", "position": 1}, http.StatusNoContent)
+		resp := s.request(t, http.MethodPost, path+"/events", "", map[string]any{"session_id": "one", "type": "progress", "position": 2}, http.StatusTooManyRequests)
+		if resp.Header.Get("Retry-After") == "" {
+			t.Errorf("POST %s/events 429 has no Retry-After", path)
+		}
+
+		s.request(t, http.MethodGet, path+"/analytics", viewer.Token, nil, http.StatusForbidden)
+		analytics := decodeBody[struct {
+			Totals struct {
+				Views int `json:"views"`
+			} `json:"totals"`
+		}](t, s.request(t, http.MethodGet, path+"/analytics", owner.Token, nil, http.StatusOK))
+		if analytics.Totals.Views != 1 {
+			t.Errorf("GET %s/analytics views = %d, want 1", path, analytics.Totals.Views)
+		}
+
+		s.request(t, http.MethodPut, path+"/reaction", viewer.Token, map[string]string{"reaction": "meh"}, http.StatusBadRequest)
+		reactions := decodeBody[reactionsResponse](t, s.request(t, http.MethodPut, path+"/reaction", viewer.Token, map[string]string{"reaction": database.ReactionLike}, http.StatusOK))
+		if reactions.Reactions[database.ReactionLike] != 1 || reactions.MyReaction == nil || *reactions.MyReaction != database.ReactionLike {
+			t.Errorf("PUT %s/reaction = %+v, want one like by the caller", path, reactions)
+		}
+		reactions = decodeBody[reactionsResponse](t, s.request(t, http.MethodDelete, path+"/reaction", viewer.Token, nil, http.StatusOK))
+		if reactions.Reactions[database.ReactionLike] != 0 || reactions.MyReaction != nil {
+			t.Errorf("DELETE %s/reaction = %+v, want no reactions", path, reactions)
+		}
+	})
+}
+
+func TestCommentRoutes(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *testServer) {
+		owner := s.signUp(t)
+		viewer := s.signUp(t)
+		video := s.createVideo(t, owner.Token, map[string]any{"title": "Discussed", "visibility": database.VisibilityPublic})
+		path := "/api/videos/" + video.ID.String() + "/comments"
+
+		s.request(t, http.MethodPost, path, viewer.Token, map[string]string{"body": " "}, http.StatusBadRequest)
+		comment := decodeBody[database.Comment](t, s.request(t, http.MethodPost, path, viewer.Token, map[string]string{"body": "First"}, http.StatusCreated))
+		commentPath := path + "/" + comment.ID.String()
+		s.request(t, http.MethodPost, path, owner.Token, map[string]any{"body": "Thanks", "parent_id": comment.ID}, http.StatusCreated)
+
+		comments := decodeBody[[]database.Comment](t, s.request(t, http.MethodGet, path, "", nil, http.StatusOK))
+		if len(comments) != 1 || comments[0].ReplyCount != 1 {
+			t.Fatalf("GET %s = %+v, want one comment with a reply", path, comments)
+		}
+		replies := decodeBody[[]database.Comment](t, s.request(t, http.MethodGet, commentPath+"/replies", "", nil, http.StatusOK))
+		if len(replies) != 1 || replies[0].Body != "Thanks" {
+			t.Errorf("GET %s/replies = %+v, want the reply", commentPath, replies)
+		}
+
+		s.request(t, http.MethodPatch, commentPath, owner.Token, map[string]string{"body": "Edited"}, http.StatusForbidden)
+		edited := decodeBody[database.Comment](t, s.request(t, http.MethodPatch, commentPath, viewer.Token, map[string]string{"body": "Edited"}, http.StatusOK))
+		if edited.Body != "Edited" {
+			t.Errorf("PATCH %s body = %q, want %q", commentPath, edited.Body, "Edited")
+		}
+		pinned := decodeBody[database.Comment](t, s.request(t, http.MethodPut, commentPath+"/pin", owner.Token, map[string]bool{"pinned": true}, http.StatusOK))
+		if !pinned.Pinned {
+			t.Errorf("PUT %s/pin didn't pin the comment", commentPath)
+		}
+
+		for range maxCommentsPerMinute - 1 {
+			s.request(t, http.MethodPost, path, viewer.Token, map[string]string{"body": "Again"}, http.StatusCreated)
+		}
+		resp := s.request(t, http.MethodPost, path, viewer.Token, map[string]string{"body": "Too many"}, http.StatusTooManyRequests)
+		if resp.Header.Get("Retry-After") == "" {
+			t.Errorf("POST %s 429 has no Retry-After", path)
+		}
+
+		settingsPath := "/api/videos/" + video.ID.String() + "/comment_settings"
+		s.request(t, http.MethodPut, settingsPath, viewer.Token, map[string]bool{"disabled": true}, http.StatusForbidden)
+		settings := decodeBody[database.Video](t, s.request(t, http.MethodPut, settingsPath, owner.Token, map[string]bool{"disabled": true}, http.StatusOK))
+		if !settings.CommentsDisabled {
+			t.Errorf("PUT %s didn't disable comments", settingsPath)
+		}
+		s.request(t, http.MethodPost, path, owner.Token, map[string]string{"body": "Closed"}, http.StatusForbidden)
+
+		s.request(t, http.MethodDelete, commentPath, viewer.Token, nil, http.StatusNoContent)
+		s.request(t, http.MethodGet, commentPath+"/replies", "", nil, http.StatusNotFound)
+	})
+}
+
+func TestPlaylistRoutes(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *testServer) {
+		owner := s.signUp(t)
+		other := s.signUp(t)
+		first := s.createVideo(t, owner.Token, map[string]any{"title": "First"})
+		second := s.createVideo(t, owner.Token, map[string]any{"title": "Second"})
+		foreign := s.createVideo(t, other.Token, map[string]any{"title": "Not mine"})
+
+		playlist := decodeBody[database.Playlist](t, s.request(t, http.MethodPost, "/api/playlists", owner.Token, map[string]string{"title": "Favourites"}, http.StatusCreated))
+		path := "/api/playlists/" + playlist.ID.String()
+		playlists := decodeBody[[]database.Playlist](t, s.request(t, http.MethodGet, "/api/playlists", owner.Token, nil, http.StatusOK))
+		if len(playlists) != 1 {
+			t.Errorf("GET /api/playlists = %d playlists, want 1", len(playlists))
+		}
+
+		s.request(t, http.MethodPost, path+"/items", owner.Token, map[string]any{"video_id": foreign.ID}, http.StatusForbidden)
+		s.request(t, http.MethodPost, path+"/items", other.Token, map[string]any{"video_id": foreign.ID}, http.StatusForbidden)
+		firstItem := decodeBody[database.PlaylistItem](t, s.request(t, http.MethodPost, path+"/items", owner.Token, map[string]any{"video_id": first.ID}, http.StatusCreated))
+		secondItem := decodeBody[database.PlaylistItem](t, s.request(t, http.MethodPost, path+"/items", owner.Token, map[string]any{"video_id": second.ID}, http.StatusCreated))
+
+		items := decodeBody[[]database.PlaylistItem](t, s.request(t, http.MethodPut, path+"/items", owner.Token, map[string]any{"item_ids": []uuid.UUID{secondItem.ID, firstItem.ID}}, http.StatusOK))
+		if len(items) != 2 || items[0].ID != secondItem.ID {
+			t.Errorf("PUT %s/items = %+v, want the second video first", path, items)
+		}
+		s.request(t, http.MethodPut, path+"/items", owner.Token, map[string]any{"item_ids": []uuid.UUID{firstItem.ID}}, http.StatusBadRequest)
+		items = decodeBody[[]database.PlaylistItem](t, s.request(t, http.MethodPatch, path+"/items/"+firstItem.ID.String(), owner.Token, map[string]int{"position": 0}, http.StatusOK))
+		if len(items) != 2 || items[0].ID != firstItem.ID {
+			t.Errorf("PATCH %s/items/%s = %+v, want the first video first", path, firstItem.ID, items)
+		}
+		s.request(t, http.MethodDelete, path+"/items/"+secondItem.ID.String(), owner.Token, nil, http.StatusNoContent)
+
+		s.request(t, http.MethodGet, path, other.Token, nil, http.StatusNotFound)
+		got := decodeBody[struct {
+			database.Playlist
+			Items []database.PlaylistItem `json:"items"`
+		}](t, s.request(t, http.MethodGet, path, owner.Token, nil, http.StatusOK))
+		if len(got.Items) != 1 || got.Items[0].Video.ID != first.ID {
+			t.Errorf("GET %s items = %+v, want only the first video", path, got.Items)
+		}
+
+		s.request(t, http.MethodPut, path, other.Token, map[string]string{"title": "Mine"}, http.StatusForbidden)
+		updated := decodeBody[database.Playlist](t, s.request(t, http.MethodPut, path, owner.Token, map[string]string{"title": "Best", "visibility": database.VisibilityPublic}, http.StatusOK))
+		if updated.Title != "Best" || updated.Visibility != database.VisibilityPublic {
+			t.Errorf("PUT %s = %q %s, want %q public", path, updated.Title, updated.Visibility, "Best")
+		}
+		s.request(t, http.MethodGet, path, "", nil, http.StatusOK)
+
+		s.upload(t, path+"/thumbnail", owner.Token, "thumbnail", "cover.gif", "image/gif", pngPixel, nil, http.StatusBadRequest)
+		withThumbnail := decodeBody[database.Playlist](t, s.upload(t, path+"/thumbnail", owner.Token, "thumbnail", "cover.png", "image/png", pngPixel, nil, http.StatusOK))
+		if withThumbnail.ThumbnailURL == nil {
+			t.Errorf("POST %s/thumbnail didn't set thumbnail_url", path)
+		}
+
+		s.request(t, http.MethodDelete, path, other.Token, nil, http.StatusForbidden)
+		s.request(t, http.MethodDelete, path, owner.Token, nil, http.StatusNoContent)
+		s.request(t, http.MethodGet, path, owner.Token, nil, http.StatusNotFound)
+	})
+}
+
+func TestAdminRoutes(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *testServer) {
+		owner := s.signUp(t)
+		video := s.createVideo(t, owner.Token, map[string]any{"title": "Unprocessed"})
+		path := "/admin/videos/" + video.ID.String() + "/reprocess"
+
+		adminRequest := func(path, key string) *http.Request {
+			req := newRequest(t, http.MethodPost, path, "", nil)
+			req.Header.Set("Authorization", "ApiKey "+key)
+			return req
+		}
+		s.send(t, adminRequest(path, "wrong"), http.StatusUnauthorized)
+		s.send(t, adminRequest(path, testAdminKey), http.StatusConflict)
+		s.send(t, adminRequest("/admin/videos/"+uuid.NewString()+"/reprocess", testAdminKey), http.StatusNotFound)
+		s.send(t, adminRequest("/admin/videos/reprocess", testAdminKey), http.StatusAccepted)
+
+		s.cfg.adminAPIKey = ""
+		s.send(t, adminRequest(path, testAdminKey), http.StatusForbidden)
+
+		s.cfg.platform = "prod"
+		s.request(t, http.MethodPost, "/admin/reset", "", nil, http.StatusForbidden)
+		s.cfg.platform = "dev"
+		s.request(t, http.MethodPost, "/admin/reset", "", nil, http.StatusOK)
+		s.request(t, http.MethodPost, "/api/login", "", map[string]string{"email": owner.Email, "password": testPassword}, http.StatusUnauthorized)
+	})
+}
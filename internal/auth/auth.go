@@ -2,6 +2,8 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -38,50 +40,83 @@ func CheckPasswordHash(password, hash string) (bool, error) {
 	return match, nil
 }
 
+// AccessTokenAudience is the aud claim of access tokens. Tokens minted for
+// anything else are rejected.
+const AccessTokenAudience = "tubely-api"
+
+// AccessClaims is what a valid access token says about its bearer.
+type AccessClaims struct {
+	// ID is the token's jti.
+	ID     string
+	UserID uuid.UUID
+	// TokenVersion must match the user's current version for the token to
+	// be accepted.
+	TokenVersion int
+}
+
+type accessTokenClaims struct {
+	jwt.RegisteredClaims
+	TokenVersion int `json:"ver"`
+}
+
 func MakeJWT(
 	userID uuid.UUID,
+	tokenVersion int,
 	tokenSecret string,
 	expiresIn time.Duration,
 ) (string, error) {
 	signingKey := []byte(tokenSecret)
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
-		Issuer:    string(TokenTypeAccess),
-		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
-		Subject:   userID.String(),
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, accessTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Issuer:    string(TokenTypeAccess),
+			Audience:  jwt.ClaimStrings{AccessTokenAudience},
+			IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
+			Subject:   userID.String(),
+		},
+		TokenVersion: tokenVersion,
 	})
 	return token.SignedString(signingKey)
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	claimsStruct := jwt.RegisteredClaims{}
+// ValidateJWT checks an access token's signature, expiry, issuer and
+// audience. Comparing TokenVersion with the user's is left to the caller.
+func ValidateJWT(tokenString, tokenSecret string) (AccessClaims, error) {
+	claimsStruct := accessTokenClaims{}
 	token, err := jwt.ParseWithClaims(
 		tokenString,
 		&claimsStruct,
 		func(token *jwt.Token) (interface{}, error) { return []byte(tokenSecret), nil },
+		jwt.WithAudience(AccessTokenAudience),
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
 	)
 	if err != nil {
-		return uuid.Nil, err
+		return AccessClaims{}, err
 	}
 
 	userIDString, err := token.Claims.GetSubject()
 	if err != nil {
-		return uuid.Nil, err
+		return AccessClaims{}, err
 	}
 
 	issuer, err := token.Claims.GetIssuer()
 	if err != nil {
-		return uuid.Nil, err
+		return AccessClaims{}, err
 	}
 	if issuer != string(TokenTypeAccess) {
-		return uuid.Nil, errors.New("invalid issuer")
+		return AccessClaims{}, errors.New("invalid issuer")
 	}
 
 	id, err := uuid.Parse(userIDString)
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("invalid user ID: %w", err)
+		return AccessClaims{}, fmt.Errorf("invalid user ID: %w", err)
 	}
-	return id, nil
+	return AccessClaims{
+		ID:           claimsStruct.ID,
+		UserID:       id,
+		TokenVersion: claimsStruct.TokenVersion,
+	}, nil
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
@@ -97,13 +132,53 @@ func GetBearerToken(headers http.Header) (string, error) {
 	return splitAuth[1], nil
 }
 
-func MakeRefreshToken() (string, error) {
-	token := make([]byte, 32)
-	_, err := rand.Read(token)
+// RefreshToken is handed to clients as "<id>.<secret>". Only the ID and the
+// hash of the secret are stored, so a database leak doesn't leak sessions.
+type RefreshToken struct {
+	ID     uuid.UUID
+	Secret string
+}
+
+var ErrMalformedRefreshToken = errors.New("malformed refresh token")
+
+func MakeRefreshToken() (RefreshToken, error) {
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
 	if err != nil {
-		return "", err
+		return RefreshToken{}, err
 	}
-	return hex.EncodeToString(token), nil
+	return RefreshToken{
+		ID:     uuid.New(),
+		Secret: hex.EncodeToString(secret),
+	}, nil
+}
+
+func ParseRefreshToken(token string) (RefreshToken, error) {
+	idString, secret, ok := strings.Cut(token, ".")
+	if !ok || secret == "" {
+		return RefreshToken{}, ErrMalformedRefreshToken
+	}
+	id, err := uuid.Parse(idString)
+	if err != nil {
+		return RefreshToken{}, ErrMalformedRefreshToken
+	}
+	return RefreshToken{ID: id, Secret: secret}, nil
+}
+
+func (t RefreshToken) String() string {
+	return t.ID.String() + "." + t.Secret
+}
+
+// Hash is the SHA-256 of the secret, hex encoded, as stored in the database.
+func (t RefreshToken) Hash() string {
+	sum := sha256.Sum256([]byte(t.Secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// CheckRefreshTokenHash reports whether the token's secret matches a stored
+// hash, in constant time.
+func CheckRefreshTokenHash(t RefreshToken, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(t.Hash()), []byte(hash)) == 1
 }
 
 func GetAPIKey(headers http.Header) (string, error) {
@@ -0,0 +1,232 @@
+package captions
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Format string
+
+const (
+	FormatSRT    Format = "srt"
+	FormatWebVTT Format = "vtt"
+)
+
+type Cue struct {
+	ID       string
+	Start    time.Duration
+	End      time.Duration
+	Settings string
+	Text     string
+}
+
+var ErrEmptyTrack = errors.New("caption track has no cues")
+
+// Parse reads an SRT or WebVTT document and returns its cues after
+// validating that every cue ends after it starts and that cues are
+// ordered by start time.
+func Parse(data []byte, format Format) ([]Cue, error) {
+	text := string(bytes.TrimPrefix(data, []byte("\ufeff")))
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+
+	var cues []Cue
+	var err error
+	switch format {
+	case FormatSRT:
+		cues, err = parseSRT(text)
+	case FormatWebVTT:
+		cues, err = parseVTT(text)
+	default:
+		return nil, fmt.Errorf("unsupported caption format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := Validate(cues); err != nil {
+		return nil, err
+	}
+	return cues, nil
+}
+
+// Validate checks cue timing.
+func Validate(cues []Cue) error {
+	if len(cues) == 0 {
+		return ErrEmptyTrack
+	}
+	var prevStart time.Duration
+	for i, cue := range cues {
+		if cue.Start < 0 {
+			return fmt.Errorf("cue %d: negative start time", i+1)
+		}
+		if cue.End <= cue.Start {
+			return fmt.Errorf("cue %d: end %s is not after start %s", i+1, formatTimestamp(cue.End), formatTimestamp(cue.Start))
+		}
+		if cue.Start < prevStart {
+			return fmt.Errorf("cue %d: starts at %s before the previous cue", i+1, formatTimestamp(cue.Start))
+		}
+		prevStart = cue.Start
+	}
+	return nil
+}
+
+// WriteVTT serializes cues as a WebVTT document.
+func WriteVTT(cues []Cue) []byte {
+	var b bytes.Buffer
+	b.WriteString("WEBVTT\n")
+	for _, cue := range cues {
+		b.WriteString("\n")
+		if cue.ID != "" {
+			b.WriteString(cue.ID + "\n")
+		}
+		b.WriteString(formatTimestamp(cue.Start) + " --> " + formatTimestamp(cue.End))
+		if cue.Settings != "" {
+			b.WriteString(" " + cue.Settings)
+		}
+		b.WriteString("\n")
+		b.WriteString(cue.Text + "\n")
+	}
+	return b.Bytes()
+}
+
+func parseSRT(text string) ([]Cue, error) {
+	cues := []Cue{}
+	for n, block := range splitBlocks(text) {
+		lines := strings.Split(block, "\n")
+		if !strings.Contains(lines[0], "-->") {
+			lines = lines[1:]
+		}
+		if len(lines) == 0 {
+			return nil, fmt.Errorf("block %d: missing timing line", n+1)
+		}
+		start, end, _, err := parseTimingLine(lines[0], ',')
+		if err != nil {
+			return nil, fmt.Errorf("block %d: %w", n+1, err)
+		}
+		cues = append(cues, Cue{
+			Start: start,
+			End:   end,
+			Text:  strings.Join(lines[1:], "\n"),
+		})
+	}
+	return cues, nil
+}
+
+func parseVTT(text string) ([]Cue, error) {
+	blocks := splitBlocks(text)
+	if len(blocks) == 0 || !isVTTHeader(blocks[0]) {
+		return nil, errors.New("missing WEBVTT header")
+	}
+
+	cues := []Cue{}
+	for n, block := range blocks[1:] {
+		if strings.HasPrefix(block, "NOTE") || strings.HasPrefix(block, "STYLE") || strings.HasPrefix(block, "REGION") {
+			continue
+		}
+		lines := strings.Split(block, "\n")
+		id := ""
+		if !strings.Contains(lines[0], "-->") {
+			id = lines[0]
+			lines = lines[1:]
+		}
+		if len(lines) == 0 {
+			return nil, fmt.Errorf("block %d: missing timing line", n+2)
+		}
+		start, end, settings, err := parseTimingLine(lines[0], '.')
+		if err != nil {
+			return nil, fmt.Errorf("block %d: %w", n+2, err)
+		}
+		cues = append(cues, Cue{
+			ID:       id,
+			Start:    start,
+			End:      end,
+			Settings: settings,
+			Text:     strings.Join(lines[1:], "\n"),
+		})
+	}
+	return cues, nil
+}
+
+func isVTTHeader(block string) bool {
+	first := strings.SplitN(block, "\n", 2)[0]
+	return first == "WEBVTT" || strings.HasPrefix(first, "WEBVTT ") || strings.HasPrefix(first, "WEBVTT\t")
+}
+
+func splitBlocks(text string) []string {
+	blocks := []string{}
+	for _, block := range strings.Split(text, "\n\n") {
+		block = strings.Trim(block, "\n")
+		if strings.TrimSpace(block) == "" {
+			continue
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks
+}
+
+func parseTimingLine(line string, fractionSep byte) (time.Duration, time.Duration, string, error) {
+	parts := strings.SplitN(line, "-->", 2)
+	if len(parts) != 2 {
+		return 0, 0, "", fmt.Errorf("malformed timing line %q", line)
+	}
+	start, err := parseTimestamp(strings.TrimSpace(parts[0]), fractionSep)
+	if err != nil {
+		return 0, 0, "", err
+	}
+	rest := strings.Fields(parts[1])
+	if len(rest) == 0 {
+		return 0, 0, "", fmt.Errorf("malformed timing line %q", line)
+	}
+	end, err := parseTimestamp(rest[0], fractionSep)
+	if err != nil {
+		return 0, 0, "", err
+	}
+	return start, end, strings.Join(rest[1:], " "), nil
+}
+
+// parseTimestamp accepts hh:mm:ss<sep>ttt and, for WebVTT, mm:ss.ttt.
+func parseTimestamp(ts string, fractionSep byte) (time.Duration, error) {
+	idx := strings.LastIndexByte(ts, fractionSep)
+	if idx == -1 || len(ts)-idx-1 != 3 {
+		return 0, fmt.Errorf("malformed timestamp %q", ts)
+	}
+	millis, err := strconv.Atoi(ts[idx+1:])
+	if err != nil {
+		return 0, fmt.Errorf("malformed timestamp %q", ts)
+	}
+
+	fields := strings.Split(ts[:idx], ":")
+	if len(fields) < 2 || len(fields) > 3 {
+		return 0, fmt.Errorf("malformed timestamp %q", ts)
+	}
+	values := make([]int, len(fields))
+	for i, f := range fields {
+		values[i], err = strconv.Atoi(f)
+		if err != nil || values[i] < 0 {
+			return 0, fmt.Errorf("malformed timestamp %q", ts)
+		}
+	}
+	hours := 0
+	if len(values) == 3 {
+		hours = values[0]
+		values = values[1:]
+	}
+	if values[0] > 59 || values[1] > 59 {
+		return 0, fmt.Errorf("malformed timestamp %q", ts)
+	}
+
+	return time.Duration(hours)*time.Hour +
+		time.Duration(values[0])*time.Minute +
+		time.Duration(values[1])*time.Second +
+		time.Duration(millis)*time.Millisecond, nil
+}
+
+func formatTimestamp(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
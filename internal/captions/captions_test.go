@@ -0,0 +1,171 @@
+package captions
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  Format
+		input   string
+		want    []Cue
+		wantErr string
+	}{
+		{
+			name:   "srt",
+			format: FormatSRT,
+			input:  "1\n00:00:01,000 --> 00:00:02,500\nHello\nthere\n\n2\n00:00:03,000 --> 00:00:04,000\nBye\n",
+			want: []Cue{
+				{Start: time.Second, End: 2500 * time.Millisecond, Text: "Hello\nthere"},
+				{Start: 3 * time.Second, End: 4 * time.Second, Text: "Bye"},
+			},
+		},
+		{
+			name:   "srt with BOM",
+			format: FormatSRT,
+			input:  "\ufeff1\n00:00:01,000 --> 00:00:02,000\nHello\n",
+			want: []Cue{
+				{Start: time.Second, End: 2 * time.Second, Text: "Hello"},
+			},
+		},
+		{
+			name:   "srt with CRLF line endings",
+			format: FormatSRT,
+			input:  "1\r\n00:00:01,000 --> 00:00:02,000\r\nHello\r\n\r\n2\r\n00:00:02,000 --> 00:00:03,000\r\nBye\r\n",
+			want: []Cue{
+				{Start: time.Second, End: 2 * time.Second, Text: "Hello"},
+				{Start: 2 * time.Second, End: 3 * time.Second, Text: "Bye"},
+			},
+		},
+		{
+			name:   "vtt",
+			format: FormatWebVTT,
+			input:  "WEBVTT - Example\n\nNOTE a comment\n\nintro\n00:00:01.000 --> 00:00:02.000 align:start\nHello\n",
+			want: []Cue{
+				{ID: "intro", Start: time.Second, End: 2 * time.Second, Settings: "align:start", Text: "Hello"},
+			},
+		},
+		{
+			name:   "vtt with BOM and CRLF line endings",
+			format: FormatWebVTT,
+			input:  "\ufeffWEBVTT\r\n\r\n00:00:01.000 --> 00:00:02.000\r\nHello\r\n",
+			want: []Cue{
+				{Start: time.Second, End: 2 * time.Second, Text: "Hello"},
+			},
+		},
+		{
+			name:   "vtt with mm:ss.ttt timestamps",
+			format: FormatWebVTT,
+			input:  "WEBVTT\n\n01:02.003 --> 01:04.500\nHello\n\n59:59.999 --> 01:00:00.000\nBye\n",
+			want: []Cue{
+				{Start: time.Minute + 2003*time.Millisecond, End: time.Minute + 4500*time.Millisecond, Text: "Hello"},
+				{Start: time.Hour - time.Millisecond, End: time.Hour, Text: "Bye"},
+			},
+		},
+		{
+			name:    "out of order cues",
+			format:  FormatSRT,
+			input:   "1\n00:00:05,000 --> 00:00:06,000\nLater\n\n2\n00:00:01,000 --> 00:00:02,000\nEarlier\n",
+			wantErr: "cue 2: starts at 00:00:01.000 before the previous cue",
+		},
+		{
+			name:    "end equal to start",
+			format:  FormatWebVTT,
+			input:   "WEBVTT\n\n00:00:01.000 --> 00:00:01.000\nHello\n",
+			wantErr: "cue 1: end 00:00:01.000 is not after start 00:00:01.000",
+		},
+		{
+			name:    "end before start",
+			format:  FormatSRT,
+			input:   "1\n00:00:02,000 --> 00:00:01,000\nHello\n",
+			wantErr: "cue 1: end 00:00:01.000 is not after start 00:00:02.000",
+		},
+		{
+			name:    "vtt without header",
+			format:  FormatWebVTT,
+			input:   "00:00:01.000 --> 00:00:02.000\nHello\n",
+			wantErr: "missing WEBVTT header",
+		},
+		{
+			name:    "srt with vtt fraction separator",
+			format:  FormatSRT,
+			input:   "1\n00:00:01.000 --> 00:00:02.000\nHello\n",
+			wantErr: `block 1: malformed timestamp "00:00:01.000"`,
+		},
+		{
+			name:    "seconds out of range",
+			format:  FormatWebVTT,
+			input:   "WEBVTT\n\n00:60.000 --> 01:01.000\nHello\n",
+			wantErr: `block 2: malformed timestamp "00:60.000"`,
+		},
+		{
+			name:    "unsupported format",
+			format:  Format("ass"),
+			input:   "[Script Info]\n",
+			wantErr: `unsupported caption format "ass"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse([]byte(tt.input), tt.format)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("Parse() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseEmptyTrack(t *testing.T) {
+	tests := []struct {
+		name   string
+		format Format
+		input  string
+	}{
+		{"empty srt", FormatSRT, ""},
+		{"blank srt", FormatSRT, "\r\n\r\n"},
+		{"vtt with only a header", FormatWebVTT, "\ufeffWEBVTT\r\n\r\nNOTE nothing here\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.input), tt.format)
+			if !errors.Is(err, ErrEmptyTrack) {
+				t.Errorf("Parse() error = %v, want %v", err, ErrEmptyTrack)
+			}
+		})
+	}
+}
+
+func TestWriteVTTRoundTrip(t *testing.T) {
+	cues := []Cue{
+		{ID: "1", Start: 1500 * time.Millisecond, End: 3 * time.Second, Settings: "line:0", Text: "Hello\nthere"},
+		{Start: time.Hour + time.Millisecond, End: time.Hour + time.Second, Text: "Bye"},
+	}
+
+	out := WriteVTT(cues)
+	if !strings.HasPrefix(string(out), "WEBVTT\n") {
+		t.Fatalf("WriteVTT() = %q, want a WEBVTT header", out)
+	}
+	got, err := Parse(out, FormatWebVTT)
+	if err != nil {
+		t.Fatalf("Parse(WriteVTT()) error = %v", err)
+	}
+	if !reflect.DeepEqual(got, cues) {
+		t.Errorf("Parse(WriteVTT()) = %+v, want %+v", got, cues)
+	}
+}
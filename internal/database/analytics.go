@@ -0,0 +1,236 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	PlaybackEventPlay     = "play"
+	PlaybackEventProgress = "progress"
+	PlaybackEventComplete = "complete"
+)
+
+// StatsDayLayout formats the UTC day that playback stats are grouped by.
+const StatsDayLayout = "2006-01-02"
+
+// playbackSlack is how far ahead of wall-clock time a player may report its
+// position, to absorb buffering and clock jitter between heartbeats.
+const playbackSlack = 5.0
+
+type PlaybackEvent struct {
+	VideoID uuid.UUID
+	// SessionID is chosen by the player and stays the same for one viewing.
+	SessionID string
+	Type      string
+	// Position is the playback position in seconds.
+	Position float64
+	At       time.Time
+}
+
+// PlaybackSession is the running state of one viewing of a video.
+type PlaybackSession struct {
+	StartedAt    time.Time
+	LastEventAt  time.Time
+	LastPosition float64
+	MaxPosition  float64
+	WatchTime    float64
+	Completed    bool
+}
+
+// VideoDailyStats is a video's playback on one UTC day. WatchTime is in
+// seconds.
+type VideoDailyStats struct {
+	Day         string  `json:"day"`
+	Views       int     `json:"views"`
+	WatchTime   float64 `json:"watch_time"`
+	Completions int     `json:"completions"`
+}
+
+// ApplyPlaybackEvent advances a session by one event and returns what the
+// event adds to the stats of its day. The first event of a session counts
+// the view, so repeated play events in one session count once. Only
+// playback that fits in the time since the previous event is credited as
+// watch time, so seeking ahead doesn't count as watching.
+func ApplyPlaybackEvent(session *PlaybackSession, isNew bool, event PlaybackEvent) VideoDailyStats {
+	stats := VideoDailyStats{Day: event.At.UTC().Format(StatsDayLayout)}
+	if isNew {
+		*session = PlaybackSession{
+			StartedAt:    event.At,
+			LastEventAt:  event.At,
+			LastPosition: event.Position,
+		}
+		stats.Views = 1
+	} else {
+		elapsed := max(event.At.Sub(session.LastEventAt).Seconds(), 0) + playbackSlack
+		watched := min(max(event.Position-session.LastPosition, 0), elapsed)
+		session.WatchTime += watched
+		session.LastEventAt = event.At
+		session.LastPosition = event.Position
+		stats.WatchTime = watched
+	}
+	session.MaxPosition = max(session.MaxPosition, event.Position)
+	if event.Type == PlaybackEventComplete && !session.Completed {
+		session.Completed = true
+		stats.Completions = 1
+	}
+	return stats
+}
+
+// RecordPlaybackEvent applies a player event to its session and the video's
+// daily stats. A session is started by inserting it, so when two of its
+// first events arrive together only one of them counts the view.
+func (c Client) RecordPlaybackEvent(ctx context.Context, event PlaybackEvent) error {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var session PlaybackSession
+	stats := ApplyPlaybackEvent(&session, true, event)
+	query := `
+	INSERT INTO playback_sessions (
+		video_id,
+		session_id,
+		day,
+		started_at,
+		last_event_at,
+		last_position,
+		max_position,
+		watch_time,
+		completed
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT (video_id, session_id) DO NOTHING
+	`
+	result, err := tx.ExecContext(ctx, query,
+		event.VideoID,
+		event.SessionID,
+		stats.Day,
+		c.db.dialect.timestamp(session.StartedAt),
+		c.db.dialect.timestamp(session.LastEventAt),
+		session.LastPosition,
+		session.MaxPosition,
+		session.WatchTime,
+		session.Completed,
+	)
+	if err != nil {
+		return err
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if inserted == 0 {
+		// Events for one session can arrive at once, so the row is locked
+		// until the update below has been written
+		query = `
+		SELECT started_at, last_event_at, last_position, max_position, watch_time, completed
+		FROM playback_sessions
+		WHERE video_id = ? AND session_id = ?` + tx.dialect.forUpdate()
+		err = tx.QueryRowContext(ctx, query, event.VideoID, event.SessionID).Scan(
+			&session.StartedAt,
+			&session.LastEventAt,
+			&session.LastPosition,
+			&session.MaxPosition,
+			&session.WatchTime,
+			&session.Completed,
+		)
+		if err != nil {
+			return err
+		}
+
+		stats = ApplyPlaybackEvent(&session, false, event)
+		query = `
+		UPDATE playback_sessions
+		SET
+			last_event_at = ?,
+			last_position = ?,
+			max_position = ?,
+			watch_time = ?,
+			completed = ?
+		WHERE video_id = ? AND session_id = ?
+		`
+		_, err = tx.ExecContext(ctx, query,
+			c.db.dialect.timestamp(session.LastEventAt),
+			session.LastPosition,
+			session.MaxPosition,
+			session.WatchTime,
+			session.Completed,
+			event.VideoID,
+			event.SessionID,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	query = `
+	INSERT INTO video_daily_stats (video_id, day, views, watch_time, completions)
+	VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT (video_id, day) DO UPDATE SET
+		views = video_daily_stats.views + excluded.views,
+		watch_time = video_daily_stats.watch_time + excluded.watch_time,
+		completions = video_daily_stats.completions + excluded.completions
+	`
+	_, err = tx.ExecContext(ctx, query, event.VideoID, stats.Day, stats.Views, stats.WatchTime, stats.Completions)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetVideoDailyStats returns the days between from and to, inclusive, on
+// which a video was played, oldest first.
+func (c Client) GetVideoDailyStats(ctx context.Context, videoID uuid.UUID, from, to time.Time) ([]VideoDailyStats, error) {
+	query := `
+	SELECT day, views, watch_time, completions
+	FROM video_daily_stats
+	WHERE video_id = ? AND day >= ? AND day <= ?
+	ORDER BY day
+	`
+	rows, err := c.db.QueryContext(ctx, query, videoID, from.UTC().Format(StatsDayLayout), to.UTC().Format(StatsDayLayout))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	days := []VideoDailyStats{}
+	for rows.Next() {
+		var day VideoDailyStats
+		if err := rows.Scan(&day.Day, &day.Views, &day.WatchTime, &day.Completions); err != nil {
+			return nil, err
+		}
+		days = append(days, day)
+	}
+	return days, rows.Err()
+}
+
+// GetPlaybackPositions returns how far into the video each session that
+// started between from and to, inclusive, got.
+func (c Client) GetPlaybackPositions(ctx context.Context, videoID uuid.UUID, from, to time.Time) ([]float64, error) {
+	query := `
+	SELECT max_position
+	FROM playback_sessions
+	WHERE video_id = ? AND day >= ? AND day <= ?
+	`
+	rows, err := c.db.QueryContext(ctx, query, videoID, from.UTC().Format(StatsDayLayout), to.UTC().Format(StatsDayLayout))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	positions := []float64{}
+	for rows.Next() {
+		var position float64
+		if err := rows.Scan(&position); err != nil {
+			return nil, err
+		}
+		positions = append(positions, position)
+	}
+	return positions, rows.Err()
+}
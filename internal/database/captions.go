@@ -0,0 +1,133 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Caption struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	CreateCaptionParams
+}
+
+type CreateCaptionParams struct {
+	VideoID  uuid.UUID `json:"video_id"`
+	Language string    `json:"language"`
+	Label    string    `json:"label"`
+	URL      string    `json:"url"`
+}
+
+// UpsertCaption stores the caption track for a video's language,
+// replacing any track previously uploaded for that language.
+func (c Client) UpsertCaption(ctx context.Context, params CreateCaptionParams) (Caption, error) {
+	query := `
+	INSERT INTO video_captions (
+		id,
+		created_at,
+		updated_at,
+		video_id,
+		language,
+		label,
+		url
+	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?)
+	ON CONFLICT (video_id, language) DO UPDATE SET
+		updated_at = CURRENT_TIMESTAMP,
+		label = excluded.label,
+		url = excluded.url
+	`
+	_, err := c.db.ExecContext(ctx, query, uuid.New(), params.VideoID, params.Language, params.Label, params.URL)
+	if err != nil {
+		return Caption{}, err
+	}
+
+	return c.GetCaption(ctx, params.VideoID, params.Language)
+}
+
+func (c Client) GetCaption(ctx context.Context, videoID uuid.UUID, language string) (Caption, error) {
+	query := `
+	SELECT
+		id,
+		created_at,
+		updated_at,
+		video_id,
+		language,
+		label,
+		url
+	FROM video_captions
+	WHERE video_id = ? AND language = ?
+	`
+
+	var caption Caption
+	err := c.db.QueryRowContext(ctx, query, videoID, language).Scan(
+		&caption.ID,
+		&caption.CreatedAt,
+		&caption.UpdatedAt,
+		&caption.VideoID,
+		&caption.Language,
+		&caption.Label,
+		&caption.URL,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Caption{}, ErrNotFound
+		}
+		return Caption{}, err
+	}
+
+	return caption, nil
+}
+
+func (c Client) GetCaptions(ctx context.Context, videoID uuid.UUID) ([]Caption, error) {
+	query := `
+	SELECT
+		id,
+		created_at,
+		updated_at,
+		video_id,
+		language,
+		label,
+		url
+	FROM video_captions
+	WHERE video_id = ?
+	ORDER BY language
+	`
+
+	rows, err := c.db.QueryContext(ctx, query, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	captions := []Caption{}
+	for rows.Next() {
+		var caption Caption
+		if err := rows.Scan(
+			&caption.ID,
+			&caption.CreatedAt,
+			&caption.UpdatedAt,
+			&caption.VideoID,
+			&caption.Language,
+			&caption.Label,
+			&caption.URL,
+		); err != nil {
+			return nil, err
+		}
+		captions = append(captions, caption)
+	}
+
+	return captions, rows.Err()
+}
+
+func (c Client) DeleteCaption(ctx context.Context, videoID uuid.UUID, language string) error {
+	query := `
+	DELETE FROM video_captions
+	WHERE video_id = ? AND language = ?
+	`
+	return requireRowsAffected(c.db.ExecContext(ctx, query, videoID, language))
+}
@@ -0,0 +1,87 @@
+package database
+
+import (
+	"context"
+	"github.com/google/uuid"
+)
+
+type Chapter struct {
+	ID      uuid.UUID `json:"id"`
+	VideoID uuid.UUID `json:"video_id"`
+	CreateChapterParams
+}
+
+type CreateChapterParams struct {
+	Title     string  `json:"title"`
+	StartTime float64 `json:"start_time"`
+}
+
+func (c Client) GetChapters(ctx context.Context, videoID uuid.UUID) ([]Chapter, error) {
+	query := `
+	SELECT
+		id,
+		video_id,
+		title,
+		start_time
+	FROM video_chapters
+	WHERE video_id = ?
+	ORDER BY start_time
+	`
+
+	rows, err := c.db.QueryContext(ctx, query, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	chapters := []Chapter{}
+	for rows.Next() {
+		var chapter Chapter
+		if err := rows.Scan(
+			&chapter.ID,
+			&chapter.VideoID,
+			&chapter.Title,
+			&chapter.StartTime,
+		); err != nil {
+			return nil, err
+		}
+		chapters = append(chapters, chapter)
+	}
+
+	return chapters, rows.Err()
+}
+
+// ReplaceChapters swaps the full chapter list of a video in one transaction.
+func (c Client) ReplaceChapters(ctx context.Context, videoID uuid.UUID, params []CreateChapterParams) ([]Chapter, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM video_chapters WHERE video_id = ?", videoID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+	INSERT INTO video_chapters (
+		id,
+		video_id,
+		title,
+		start_time
+	) VALUES (?, ?, ?, ?)
+	`
+	for _, p := range params {
+		_, err = tx.ExecContext(ctx, query, uuid.New(), videoID, p.Title, p.StartTime)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return c.GetChapters(ctx, videoID)
+}
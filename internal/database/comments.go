@@ -0,0 +1,279 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Comment struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Pinned    bool      `json:"pinned"`
+	// ReplyCount is always zero for replies, which can't have replies of
+	// their own.
+	ReplyCount int `json:"reply_count"`
+	CreateCommentParams
+}
+
+type CreateCommentParams struct {
+	VideoID uuid.UUID `json:"video_id"`
+	UserID  uuid.UUID `json:"user_id"`
+	// ParentID is the top-level comment this one replies to.
+	ParentID *uuid.UUID `json:"parent_id"`
+	Body     string     `json:"body"`
+}
+
+// CommentRateLimit caps how many comments a user can post within Window.
+type CommentRateLimit struct {
+	Window time.Duration
+	Max    int
+}
+
+// CommentRateLimitError is returned by CreateComment when the user has
+// already posted as many comments as Limit allows.
+type CommentRateLimitError struct {
+	Limit CommentRateLimit
+}
+
+func (e CommentRateLimitError) Error() string {
+	return fmt.Sprintf("user posted %d comments within %s", e.Limit.Max, e.Limit.Window)
+}
+
+type GetCommentsParams struct {
+	VideoID uuid.UUID
+	// ParentID lists the replies to a comment instead of the top-level
+	// comments of the video.
+	ParentID *uuid.UUID
+	Limit    int
+	Offset   int
+}
+
+type CommentPage struct {
+	Comments []Comment
+	Total    int
+}
+
+const commentColumns = `
+		id,
+		created_at,
+		updated_at,
+		pinned,
+		(SELECT COUNT(*) FROM comments replies WHERE replies.parent_id = comments.id),
+		video_id,
+		user_id,
+		parent_id,
+		body`
+
+func scanComment(row interface{ Scan(...interface{}) error }) (Comment, error) {
+	var comment Comment
+	var parentID uuid.NullUUID
+	err := row.Scan(
+		&comment.ID,
+		&comment.CreatedAt,
+		&comment.UpdatedAt,
+		&comment.Pinned,
+		&comment.ReplyCount,
+		&comment.VideoID,
+		&comment.UserID,
+		&parentID,
+		&comment.Body,
+	)
+	if parentID.Valid {
+		comment.ParentID = &parentID.UUID
+	}
+	return comment, err
+}
+
+// CreateComment posts a comment unless the user is over one of the rate
+// limits, in which case it returns a CommentRateLimitError.
+func (c Client) CreateComment(ctx context.Context, params CreateCommentParams, limits ...CommentRateLimit) (Comment, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Comment{}, err
+	}
+	defer tx.Rollback()
+
+	// Writing to the user's row first locks it, so concurrent comments by
+	// the same user are counted one after another
+	err = requireRowsAffected(tx.ExecContext(ctx, "UPDATE users SET updated_at = updated_at WHERE id = ?", params.UserID))
+	if err != nil {
+		return Comment{}, err
+	}
+	for _, limit := range limits {
+		var count int
+		query := `
+		SELECT COUNT(*)
+		FROM comments
+		WHERE user_id = ? AND created_at > ?
+		`
+		since := time.Now().Add(-limit.Window)
+		err = tx.QueryRowContext(ctx, query, params.UserID, c.db.dialect.timestamp(since)).Scan(&count)
+		if err != nil {
+			return Comment{}, err
+		}
+		if count >= limit.Max {
+			return Comment{}, CommentRateLimitError{Limit: limit}
+		}
+	}
+
+	id := uuid.New()
+	query := `
+	INSERT INTO comments (
+		id,
+		created_at,
+		updated_at,
+		video_id,
+		user_id,
+		parent_id,
+		body
+	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?)
+	`
+	_, err = tx.ExecContext(ctx, query, id, params.VideoID, params.UserID, params.ParentID, params.Body)
+	if err != nil {
+		return Comment{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Comment{}, err
+	}
+	return c.GetComment(ctx, id)
+}
+
+func (c Client) GetComment(ctx context.Context, id uuid.UUID) (Comment, error) {
+	query := `
+	SELECT` + commentColumns + `
+	FROM comments
+	WHERE id = ?
+	`
+	comment, err := scanComment(c.db.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Comment{}, ErrNotFound
+	}
+	return comment, err
+}
+
+// GetComments returns a page of a video's top-level comments, pinned first
+// and then newest first, or of a comment's replies, oldest first.
+func (c Client) GetComments(ctx context.Context, params GetCommentsParams) (CommentPage, error) {
+	where := "video_id = ? AND parent_id IS NULL"
+	args := []interface{}{params.VideoID}
+	order := "pinned DESC, created_at DESC, id"
+	if params.ParentID != nil {
+		where = "video_id = ? AND parent_id = ?"
+		args = append(args, *params.ParentID)
+		order = "created_at, id"
+	}
+
+	var total int
+	err := c.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM comments WHERE "+where, args...).Scan(&total)
+	if err != nil {
+		return CommentPage{}, err
+	}
+
+	query := `
+	SELECT` + commentColumns + `
+	FROM comments
+	WHERE ` + where + `
+	ORDER BY ` + order + `
+	LIMIT ? OFFSET ?
+	`
+	rows, err := c.db.QueryContext(ctx, query, append(args, params.Limit, params.Offset)...)
+	if err != nil {
+		return CommentPage{}, err
+	}
+	defer rows.Close()
+
+	page := CommentPage{Comments: []Comment{}, Total: total}
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			return CommentPage{}, err
+		}
+		page.Comments = append(page.Comments, comment)
+	}
+	return page, rows.Err()
+}
+
+func (c Client) UpdateComment(ctx context.Context, id uuid.UUID, body string) (Comment, error) {
+	query := `
+	UPDATE comments
+	SET body = ?, updated_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	`
+	err := requireRowsAffected(c.db.ExecContext(ctx, query, body, id))
+	if err != nil {
+		return Comment{}, err
+	}
+	return c.GetComment(ctx, id)
+}
+
+// DeleteComment deletes a comment together with its replies.
+func (c Client) DeleteComment(ctx context.Context, id uuid.UUID) error {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM comments WHERE parent_id = ?", id)
+	if err != nil {
+		return err
+	}
+	err = requireRowsAffected(tx.ExecContext(ctx, "DELETE FROM comments WHERE id = ?", id))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// PinComment pins or unpins a top-level comment. A video has at most one
+// pinned comment, so pinning unpins any other.
+func (c Client) PinComment(ctx context.Context, id uuid.UUID, pinned bool) error {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var videoID uuid.UUID
+	err = tx.QueryRowContext(ctx, "SELECT video_id FROM comments WHERE id = ? AND parent_id IS NULL", id).Scan(&videoID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if pinned {
+		_, err = tx.ExecContext(ctx, "UPDATE comments SET pinned = ? WHERE video_id = ? AND pinned = ?", false, videoID, true)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE comments SET pinned = ? WHERE id = ?", pinned, id)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SetCommentsDisabled turns new comments on a video on or off without
+// touching the rest of the row.
+func (c Client) SetCommentsDisabled(ctx context.Context, videoID uuid.UUID, disabled bool) (Video, error) {
+	query := `
+	UPDATE videos
+	SET updated_at = CURRENT_TIMESTAMP, version = version + 1, comments_disabled = ?
+	WHERE id = ? AND deleted_at IS NULL
+	`
+	err := requireRowsAffected(c.db.ExecContext(ctx, query, disabled, videoID))
+	if err != nil {
+		return Video{}, err
+	}
+	return c.GetVideo(ctx, videoID)
+}
@@ -1,89 +1,96 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 )
 
 type Client struct {
-	db *sql.DB
+	db *conn
 }
 
+// NewClient opens the database and makes sure its schema isn't newer than
+// this build. Pending migrations are not applied, see MigrateUp.
+//
+// A postgres:// or postgresql:// URL connects to Postgres, anything else is
+// opened as a SQLite database file.
 func NewClient(pathToDB string) (Client, error) {
-	db, err := sql.Open("sqlite3", pathToDB)
+	d, dsn := dialectFor(pathToDB)
+	db, err := sql.Open(d.driverName(), dsn)
 	if err != nil {
 		return Client{}, err
 	}
-	c := Client{db}
-	err = c.autoMigrate()
+	err = db.Ping()
 	if err != nil {
 		return Client{}, err
 	}
-	return c, nil
-
-}
-
-func (c *Client) autoMigrate() error {
-	userTable := `
-	CREATE TABLE IF NOT EXISTS users (
-		id TEXT PRIMARY KEY,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		password TEXT NOT NULL,
-		email TEXT UNIQUE NOT NULL
-	);
-	`
-	_, err := c.db.Exec(userTable)
+	c := Client{&conn{DB: db, dialect: d}}
+	err = c.ensureMigrationsTable()
 	if err != nil {
-		return err
-	}
-	refreshTokenTable := `
-	CREATE TABLE IF NOT EXISTS refresh_tokens (
-		token TEXT PRIMARY KEY,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		revoked_at TIMESTAMP,
-		user_id TEXT NOT NULL,
-		expires_at TIMESTAMP NOT NULL,
-		FOREIGN KEY(user_id) REFERENCES users(id)
-	);
-	`
-	_, err = c.db.Exec(refreshTokenTable)
-	if err != nil {
-		return err
+		return Client{}, err
 	}
-
-	videoTable := `
-	CREATE TABLE IF NOT EXISTS videos (
-		id TEXT PRIMARY KEY,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		title TEXT NOT NULL,
-		description TEXT,
-		thumbnail_url TEXT,
-		video_url TEXT TEXT,
-		user_id INTEGER,
-		FOREIGN KEY(user_id) REFERENCES users(id)
-	);
-	`
-	_, err = c.db.Exec(videoTable)
+	err = c.checkSchemaVersion()
 	if err != nil {
-		return err
+		return Client{}, err
 	}
-	return nil
+	return c, nil
 }
 
-func (c Client) Reset() error {
-	if _, err := c.db.Exec("DELETE FROM refresh_tokens"); err != nil {
+func (c Client) Reset(ctx context.Context) error {
+	if _, err := c.db.ExecContext(ctx, "DELETE FROM webhook_deliveries"); err != nil {
+		return fmt.Errorf("failed to reset table webhook_deliveries: %w", err)
+	}
+	if _, err := c.db.ExecContext(ctx, "DELETE FROM playlist_items"); err != nil {
+		return fmt.Errorf("failed to reset table playlist_items: %w", err)
+	}
+	if _, err := c.db.ExecContext(ctx, "DELETE FROM playlists"); err != nil {
+		return fmt.Errorf("failed to reset table playlists: %w", err)
+	}
+	if _, err := c.db.ExecContext(ctx, "DELETE FROM video_tags"); err != nil {
+		return fmt.Errorf("failed to reset table video_tags: %w", err)
+	}
+	if _, err := c.db.ExecContext(ctx, "DELETE FROM tags"); err != nil {
+		return fmt.Errorf("failed to reset table tags: %w", err)
+	}
+	if _, err := c.db.ExecContext(ctx, "DELETE FROM video_reactions"); err != nil {
+		return fmt.Errorf("failed to reset table video_reactions: %w", err)
+	}
+	if _, err := c.db.ExecContext(ctx, "DELETE FROM comments"); err != nil {
+		return fmt.Errorf("failed to reset table comments: %w", err)
+	}
+	if _, err := c.db.ExecContext(ctx, "DELETE FROM video_daily_stats"); err != nil {
+		return fmt.Errorf("failed to reset table video_daily_stats: %w", err)
+	}
+	if _, err := c.db.ExecContext(ctx, "DELETE FROM playback_sessions"); err != nil {
+		return fmt.Errorf("failed to reset table playback_sessions: %w", err)
+	}
+	if _, err := c.db.ExecContext(ctx, "DELETE FROM video_revisions"); err != nil {
+		return fmt.Errorf("failed to reset table video_revisions: %w", err)
+	}
+	if _, err := c.db.ExecContext(ctx, "DELETE FROM video_fingerprints"); err != nil {
+		return fmt.Errorf("failed to reset table video_fingerprints: %w", err)
+	}
+	if _, err := c.db.ExecContext(ctx, "DELETE FROM video_chapters"); err != nil {
+		return fmt.Errorf("failed to reset table video_chapters: %w", err)
+	}
+	if _, err := c.db.ExecContext(ctx, "DELETE FROM video_captions"); err != nil {
+		return fmt.Errorf("failed to reset table video_captions: %w", err)
+	}
+	if _, err := c.db.ExecContext(ctx, "DELETE FROM refresh_tokens"); err != nil {
 		return fmt.Errorf("failed to reset table refresh_tokens: %w", err)
 	}
-	if _, err := c.db.Exec("DELETE FROM users"); err != nil {
-		return fmt.Errorf("failed to reset table users: %w", err)
+	if _, err := c.db.ExecContext(ctx, "DELETE FROM sessions"); err != nil {
+		return fmt.Errorf("failed to reset table sessions: %w", err)
 	}
-	if _, err := c.db.Exec("DELETE FROM videos"); err != nil {
+	if _, err := c.db.ExecContext(ctx, "DELETE FROM videos"); err != nil {
 		return fmt.Errorf("failed to reset table videos: %w", err)
 	}
+	if _, err := c.db.ExecContext(ctx, "DELETE FROM users"); err != nil {
+		return fmt.Errorf("failed to reset table users: %w", err)
+	}
 	return nil
 }
@@ -0,0 +1,530 @@
+package database_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// postgresEnv names the database the Postgres run uses. Its tables are
+// dropped and recreated, so don't point it at anything you want to keep.
+const postgresEnv = "TEST_DATABASE_URL"
+
+// forEachDialect runs test against a freshly migrated SQLite database and,
+// when postgresEnv is set, an emptied Postgres database.
+func forEachDialect(t *testing.T, test func(t *testing.T, db database.Client)) {
+	t.Run("sqlite", func(t *testing.T) {
+		test(t, newSQLiteClient(t))
+	})
+	t.Run("postgres", func(t *testing.T) {
+		test(t, newPostgresClient(t))
+	})
+}
+
+func newSQLiteClient(t *testing.T) database.Client {
+	t.Helper()
+	db, err := database.NewClient(filepath.Join(t.TempDir(), "tubely.db"))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	migrateUp(t, db)
+	return db
+}
+
+func newPostgresClient(t *testing.T) database.Client {
+	t.Helper()
+	dsn := os.Getenv(postgresEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", postgresEnv)
+	}
+	db, err := database.NewClient(dsn)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	migrateUp(t, db)
+	if err := db.Reset(context.Background()); err != nil {
+		t.Fatalf("Reset() error = %v", err)
+	}
+	return db
+}
+
+func migrateUp(t *testing.T, db database.Client) {
+	t.Helper()
+	if _, err := db.MigrateUp(); err != nil {
+		t.Fatalf("MigrateUp() error = %v", err)
+	}
+}
+
+func createUser(t *testing.T, db database.Client) *database.User {
+	t.Helper()
+	user, err := db.CreateUser(context.Background(), database.CreateUserParams{
+		Email:    uuid.NewString() + "@example.com",
+		Password: "hash",
+	})
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	return user
+}
+
+func createVideo(t *testing.T, db database.Client, params database.CreateVideoParams) database.Video {
+	t.Helper()
+	video, err := db.CreateVideo(context.Background(), params)
+	if err != nil {
+		t.Fatalf("CreateVideo() error = %v", err)
+	}
+	return video
+}
+
+func TestMigrations(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, db database.Client) {
+		latest, err := db.LatestSchemaVersion()
+		if err != nil {
+			t.Fatalf("LatestSchemaVersion() error = %v", err)
+		}
+		if ran, err := db.MigrateTo(0); err != nil || ran != latest {
+			t.Fatalf("MigrateTo(0) = %d, %v, want %d, nil", ran, err, latest)
+		}
+		if ran, err := db.MigrateUp(); err != nil || ran != latest {
+			t.Fatalf("MigrateUp() = %d, %v, want %d, nil", ran, err, latest)
+		}
+		if version, err := db.SchemaVersion(); err != nil || version != latest {
+			t.Fatalf("SchemaVersion() = %d, %v, want %d, nil", version, err, latest)
+		}
+	})
+}
+
+func TestUsers(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, db database.Client) {
+		ctx := context.Background()
+		user := createUser(t, db)
+
+		_, err := db.CreateUser(ctx, user.CreateUserParams)
+		if !errors.Is(err, database.ErrConflict) {
+			t.Fatalf("CreateUser() with a taken email error = %v, want %v", err, database.ErrConflict)
+		}
+		got, err := db.GetUserByEmail(ctx, user.Email)
+		if err != nil || got.ID != user.ID {
+			t.Fatalf("GetUserByEmail() = %v, %v, want user %v", got.ID, err, user.ID)
+		}
+
+		token := database.CreateRefreshTokenParams{
+			ID:        uuid.New(),
+			TokenHash: "hash",
+			UserID:    user.ID,
+			ExpiresAt: time.Now().Add(time.Hour),
+		}
+		if _, err := db.CreateRefreshToken(ctx, token); err != nil {
+			t.Fatalf("CreateRefreshToken() error = %v", err)
+		}
+		if err := db.DeleteUser(ctx, user.ID); err != nil {
+			t.Fatalf("DeleteUser() error = %v", err)
+		}
+		// The user's sessions and refresh tokens go with it.
+		if _, err := db.GetRefreshToken(ctx, token.ID); !errors.Is(err, database.ErrNotFound) {
+			t.Errorf("GetRefreshToken() after DeleteUser() error = %v, want %v", err, database.ErrNotFound)
+		}
+	})
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, db database.Client) {
+		ctx := context.Background()
+		user := createUser(t, db)
+		first, err := db.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
+			ID:        uuid.New(),
+			TokenHash: "first",
+			UserID:    user.ID,
+			ExpiresAt: time.Now().Add(time.Hour),
+			UserAgent: "test",
+		})
+		if err != nil {
+			t.Fatalf("CreateRefreshToken() error = %v", err)
+		}
+
+		second, err := db.RotateRefreshToken(ctx, first.ID, database.CreateRefreshTokenParams{
+			ID:        uuid.New(),
+			TokenHash: "second",
+			ExpiresAt: time.Now().Add(time.Hour),
+		})
+		if err != nil {
+			t.Fatalf("RotateRefreshToken() error = %v", err)
+		}
+		if second.FamilyID != first.FamilyID || second.UserID != user.ID {
+			t.Errorf("RotateRefreshToken() = family %v user %v, want family %v user %v", second.FamilyID, second.UserID, first.FamilyID, user.ID)
+		}
+
+		_, err = db.RotateRefreshToken(ctx, first.ID, database.CreateRefreshTokenParams{
+			ID:        uuid.New(),
+			TokenHash: "third",
+			ExpiresAt: time.Now().Add(time.Hour),
+		})
+		if !errors.Is(err, database.ErrTokenReused) {
+			t.Fatalf("RotateRefreshToken() of a rotated token error = %v, want %v", err, database.ErrTokenReused)
+		}
+		// Reuse revokes the whole session, including the token it was
+		// rotated to.
+		sessions, err := db.GetSessions(ctx, user.ID)
+		if err != nil || len(sessions) != 0 {
+			t.Errorf("GetSessions() = %d sessions, %v, want none", len(sessions), err)
+		}
+		got, err := db.GetRefreshToken(ctx, second.ID)
+		if err != nil {
+			t.Fatalf("GetRefreshToken() error = %v", err)
+		}
+		if err := database.CheckRefreshToken(got, time.Now()); !errors.Is(err, database.ErrTokenRevoked) {
+			t.Errorf("CheckRefreshToken() error = %v, want %v", err, database.ErrTokenRevoked)
+		}
+	})
+}
+
+func TestUpdateVideoMetadata(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, db database.Client) {
+		ctx := context.Background()
+		user := createUser(t, db)
+		video := createVideo(t, db, database.CreateVideoParams{Title: "Before", UserID: user.ID})
+
+		title := "After"
+		updated, err := db.UpdateVideoMetadata(ctx, video.ID, database.UpdateVideoMetadataParams{
+			Title:     &title,
+			UserID:    user.ID,
+			IfVersion: &video.Version,
+		})
+		if err != nil {
+			t.Fatalf("UpdateVideoMetadata() error = %v", err)
+		}
+		if updated.Title != title || updated.Version != video.Version+1 {
+			t.Errorf("UpdateVideoMetadata() = %q version %d, want %q version %d", updated.Title, updated.Version, title, video.Version+1)
+		}
+
+		stale := "Stale"
+		_, err = db.UpdateVideoMetadata(ctx, video.ID, database.UpdateVideoMetadataParams{
+			Title:     &stale,
+			UserID:    user.ID,
+			IfVersion: &video.Version,
+		})
+		if !errors.Is(err, database.ErrModified) {
+			t.Fatalf("UpdateVideoMetadata() at a stale version error = %v, want %v", err, database.ErrModified)
+		}
+		got, err := db.GetVideo(ctx, video.ID)
+		if err != nil || got.Title != title {
+			t.Errorf("GetVideo() = %q, %v, want %q", got.Title, err, title)
+		}
+	})
+}
+
+func TestReviseVideo(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, db database.Client) {
+		ctx := context.Background()
+		user := createUser(t, db)
+		video := createVideo(t, db, database.CreateVideoParams{Title: "Original", UserID: user.ID})
+
+		// Each revision only writes its own columns, so a thumbnail saved
+		// while the video was processing survives the processed file being
+		// saved from the earlier snapshot.
+		stale := video
+		thumbnail := "https://example.com/thumb.png"
+		video.ThumbnailURL = &thumbnail
+		if _, err := db.ReviseVideoThumbnail(ctx, video, user.ID); err != nil {
+			t.Fatalf("ReviseVideoThumbnail() error = %v", err)
+		}
+		url := "https://example.com/video.mp4"
+		stale.Title = "Stale"
+		stale.VideoURL = &url
+		stale.ProcessingStatus = database.ProcessingStatusReady
+		revised, err := db.ReviseVideoFile(ctx, stale, user.ID)
+		if err != nil {
+			t.Fatalf("ReviseVideoFile() error = %v", err)
+		}
+		if revised.Title != video.Title || revised.VideoURL == nil || *revised.VideoURL != url {
+			t.Errorf("ReviseVideoFile() = %q %v, want %q %q", revised.Title, revised.VideoURL, video.Title, url)
+		}
+		if revised.ThumbnailURL == nil || *revised.ThumbnailURL != thumbnail {
+			t.Errorf("ReviseVideoFile() thumbnail = %v, want %q", revised.ThumbnailURL, thumbnail)
+		}
+
+		replacement := "https://example.com/replacement.mp4"
+		revised.VideoURL = &replacement
+		if _, err := db.ReviseVideoFile(ctx, revised, user.ID); err != nil {
+			t.Fatalf("ReviseVideoFile() error = %v", err)
+		}
+
+		revisions, err := db.GetVideoRevisions(ctx, video.ID)
+		if err != nil || len(revisions) != 3 {
+			t.Fatalf("GetVideoRevisions() = %d revisions, %v, want 3", len(revisions), err)
+		}
+		var first database.VideoRevision
+		for _, r := range revisions {
+			if r.Number == 2 {
+				first = r
+			}
+		}
+		if first.Kind != database.RevisionKindVideo {
+			t.Fatalf("revision 2 kind = %q, want %q", first.Kind, database.RevisionKindVideo)
+		}
+		rolledBack, err := db.RollbackVideoRevision(ctx, video.ID, first.ID, user.ID)
+		if err != nil {
+			t.Fatalf("RollbackVideoRevision() error = %v", err)
+		}
+		if rolledBack.VideoURL == nil || *rolledBack.VideoURL != url || rolledBack.ThumbnailURL == nil || *rolledBack.ThumbnailURL != thumbnail {
+			t.Errorf("RollbackVideoRevision() = %v %v, want %q %q", rolledBack.VideoURL, rolledBack.ThumbnailURL, url, thumbnail)
+		}
+	})
+}
+
+func TestTrashKeepsPlaylistItemsAndSchedule(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, db database.Client) {
+		ctx := context.Background()
+		user := createUser(t, db)
+		publishAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+		video := createVideo(t, db, database.CreateVideoParams{Title: "Scheduled", UserID: user.ID, PublishAt: &publishAt})
+		other := createVideo(t, db, database.CreateVideoParams{Title: "Other", UserID: user.ID})
+		playlist, err := db.CreatePlaylist(ctx, database.CreatePlaylistParams{Title: "List", UserID: user.ID})
+		if err != nil {
+			t.Fatalf("CreatePlaylist() error = %v", err)
+		}
+		for _, v := range []database.Video{video, other} {
+			if _, err := db.AddPlaylistItem(ctx, playlist.ID, v.ID, nil); err != nil {
+				t.Fatalf("AddPlaylistItem() error = %v", err)
+			}
+		}
+
+		if err := db.TrashVideo(ctx, video.ID); err != nil {
+			t.Fatalf("TrashVideo() error = %v", err)
+		}
+		if _, err := db.GetVideo(ctx, video.ID); !errors.Is(err, database.ErrNotFound) {
+			t.Errorf("GetVideo() of a trashed video error = %v, want %v", err, database.ErrNotFound)
+		}
+		items, err := db.GetPlaylistItems(ctx, playlist.ID)
+		if err != nil || len(items) != 1 || items[0].Video.ID != other.ID {
+			t.Fatalf("GetPlaylistItems() while trashed = %d items, %v, want only the other video", len(items), err)
+		}
+		published, err := db.PublishDueVideos(ctx, publishAt.Add(time.Minute), nil)
+		if err != nil || len(published) != 0 {
+			t.Fatalf("PublishDueVideos() = %d videos, %v, want none while trashed", len(published), err)
+		}
+
+		if err := db.RestoreVideo(ctx, video.ID); err != nil {
+			t.Fatalf("RestoreVideo() error = %v", err)
+		}
+		items, err = db.GetPlaylistItems(ctx, playlist.ID)
+		if err != nil || len(items) != 2 || items[0].Video.ID != video.ID {
+			t.Fatalf("GetPlaylistItems() after restore = %d items, %v, want both in their old order", len(items), err)
+		}
+		restored, err := db.GetVideo(ctx, video.ID)
+		if err != nil {
+			t.Fatalf("GetVideo() error = %v", err)
+		}
+		if restored.PublishAt == nil || !restored.PublishAt.Equal(publishAt) {
+			t.Errorf("GetVideo() publish_at = %v, want %v", restored.PublishAt, publishAt)
+		}
+	})
+}
+
+func TestPublishDueVideos(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, db database.Client) {
+		ctx := context.Background()
+		user := createUser(t, db)
+		now := time.Now().UTC().Truncate(time.Second)
+		due := now.Add(-time.Minute)
+		later := now.Add(time.Hour)
+		dueVideo := createVideo(t, db, database.CreateVideoParams{Title: "Due", UserID: user.ID, PublishAt: &due})
+		createVideo(t, db, database.CreateVideoParams{Title: "Later", UserID: user.ID, PublishAt: &later})
+
+		published, err := db.PublishDueVideos(ctx, now, []string{"https://example.com/hook"})
+		if err != nil {
+			t.Fatalf("PublishDueVideos() error = %v", err)
+		}
+		if len(published) != 1 || published[0].ID != dueVideo.ID {
+			t.Fatalf("PublishDueVideos() = %d videos, want only %q", len(published), dueVideo.Title)
+		}
+		got, err := db.GetVideo(ctx, dueVideo.ID)
+		if err != nil {
+			t.Fatalf("GetVideo() error = %v", err)
+		}
+		if got.Visibility != database.VisibilityPublic || got.PublishAt != nil {
+			t.Errorf("GetVideo() = %s publish_at %v, want public and unscheduled", got.Visibility, got.PublishAt)
+		}
+
+		published, err = db.PublishDueVideos(ctx, now, nil)
+		if err != nil || len(published) != 0 {
+			t.Errorf("PublishDueVideos() again = %d videos, %v, want none", len(published), err)
+		}
+	})
+}
+
+func TestSearchVideos(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, db database.Client) {
+		ctx := context.Background()
+		user := createUser(t, db)
+		inTitle := createVideo(t, db, database.CreateVideoParams{
+			Title:       "Concurrency patterns",
+			Description: "Goroutines and channels",
+			UserID:      user.ID,
+		})
+		inDescription := createVideo(t, db, database.CreateVideoParams{
+			Title:       "Weekly update",
+			Description: "A short note on concurrency",
+			UserID:      user.ID,
+		})
+		trashed := createVideo(t, db, database.CreateVideoParams{Title: "Concurrency in the trash", UserID: user.ID})
+		createVideo(t, db, database.CreateVideoParams{Title: "Cooking pasta", UserID: user.ID})
+		createVideo(t, db, database.CreateVideoParams{Title: "Someone else's concurrency", UserID: createUser(t, db).ID})
+		if err := db.TrashVideo(ctx, trashed.ID); err != nil {
+			t.Fatalf("TrashVideo() error = %v", err)
+		}
+
+		page, err := db.SearchVideos(ctx, database.SearchVideosParams{UserID: user.ID, Query: "concurr", Limit: 10})
+		if err != nil {
+			t.Fatalf("SearchVideos() error = %v", err)
+		}
+		if page.Total != 2 || len(page.Results) != 2 {
+			t.Fatalf("SearchVideos() = %d results of %d, want 2 of 2", len(page.Results), page.Total)
+		}
+		if page.Results[0].Video.ID != inTitle.ID || page.Results[1].Video.ID != inDescription.ID {
+			t.Errorf("SearchVideos() ranked %q first, want the title match %q", page.Results[0].Video.Title, inTitle.Title)
+		}
+		if want := "\x02Concurrency\x03"; !strings.Contains(page.Results[0].TitleHighlight, want) {
+			t.Errorf("SearchVideos() title highlight = %q, want it to contain %q", page.Results[0].TitleHighlight, want)
+		}
+
+		page, err = db.SearchVideos(ctx, database.SearchVideosParams{UserID: user.ID, Query: "concurr", Limit: 1, Offset: 1})
+		if err != nil {
+			t.Fatalf("SearchVideos() error = %v", err)
+		}
+		if page.Total != 2 || len(page.Results) != 1 || page.Results[0].Video.ID != inDescription.ID {
+			t.Errorf("SearchVideos() second page = %d results of %d, want %q of 2", len(page.Results), page.Total, inDescription.Title)
+		}
+
+		_, err = db.SearchVideos(ctx, database.SearchVideosParams{UserID: user.ID, Query: "  ", Limit: 10})
+		if !errors.Is(err, database.ErrEmptySearch) {
+			t.Errorf("SearchVideos() of a blank query error = %v, want %v", err, database.ErrEmptySearch)
+		}
+	})
+}
+
+func TestRecordPlaybackEvent(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, db database.Client) {
+		ctx := context.Background()
+		user := createUser(t, db)
+		video := createVideo(t, db, database.CreateVideoParams{Title: "Watched", UserID: user.ID})
+		at := time.Now().UTC()
+
+		events := []database.PlaybackEvent{
+			{VideoID: video.ID, SessionID: "one", Type: database.PlaybackEventPlay, At: at},
+			{VideoID: video.ID, SessionID: "one", Type: database.PlaybackEventPlay, At: at.Add(time.Second)},
+			{VideoID: video.ID, SessionID: "one", Type: database.PlaybackEventComplete, Position: 10, At: at.Add(10 * time.Second)},
+			{VideoID: video.ID, SessionID: "two", Type: database.PlaybackEventPlay, At: at},
+		}
+		for _, event := range events {
+			if err := db.RecordPlaybackEvent(ctx, event); err != nil {
+				t.Fatalf("RecordPlaybackEvent(%s %s) error = %v", event.SessionID, event.Type, err)
+			}
+		}
+
+		stats, err := db.GetVideoDailyStats(ctx, video.ID, at, at)
+		if err != nil {
+			t.Fatalf("GetVideoDailyStats() error = %v", err)
+		}
+		if len(stats) != 1 || stats[0].Views != 2 || stats[0].Completions != 1 {
+			t.Errorf("GetVideoDailyStats() = %+v, want one day with 2 views and 1 completion", stats)
+		}
+	})
+}
+
+func TestCreateCommentRateLimit(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, db database.Client) {
+		ctx := context.Background()
+		user := createUser(t, db)
+		video := createVideo(t, db, database.CreateVideoParams{Title: "Commented", UserID: user.ID})
+		limit := database.CommentRateLimit{Window: time.Hour, Max: 2}
+		params := database.CreateCommentParams{VideoID: video.ID, UserID: user.ID, Body: "Nice"}
+
+		for range limit.Max {
+			if _, err := db.CreateComment(ctx, params, limit); err != nil {
+				t.Fatalf("CreateComment() error = %v", err)
+			}
+		}
+		var limitErr database.CommentRateLimitError
+		_, err := db.CreateComment(ctx, params, limit)
+		if !errors.As(err, &limitErr) || limitErr.Limit != limit {
+			t.Errorf("CreateComment() over the limit error = %v, want a CommentRateLimitError", err)
+		}
+	})
+}
+
+func TestVideoReactions(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, db database.Client) {
+		ctx := context.Background()
+		owner := createUser(t, db)
+		viewer := createUser(t, db)
+		video := createVideo(t, db, database.CreateVideoParams{Title: "Liked", UserID: owner.ID})
+
+		if err := db.SetVideoReaction(ctx, video.ID, viewer.ID, database.ReactionLike); err != nil {
+			t.Fatalf("SetVideoReaction() error = %v", err)
+		}
+		if err := db.SetVideoReaction(ctx, video.ID, viewer.ID, database.ReactionLove); err != nil {
+			t.Fatalf("SetVideoReaction() error = %v", err)
+		}
+		got, err := db.GetVideo(ctx, video.ID)
+		if err != nil {
+			t.Fatalf("GetVideo() error = %v", err)
+		}
+		if got.Reactions[database.ReactionLike] != 0 || got.Reactions[database.ReactionLove] != 1 {
+			t.Errorf("GetVideo() reactions = %v, want only one love", got.Reactions)
+		}
+		if got.Version != video.Version {
+			t.Errorf("GetVideo() version = %d, want %d, reactions don't change it", got.Version, video.Version)
+		}
+
+		if err := db.DeleteVideoReaction(ctx, video.ID, viewer.ID); err != nil {
+			t.Fatalf("DeleteVideoReaction() error = %v", err)
+		}
+		got, err = db.GetVideo(ctx, video.ID)
+		if err != nil || got.Reactions[database.ReactionLove] != 0 {
+			t.Errorf("GetVideo() reactions = %v, %v, want none", got.Reactions, err)
+		}
+	})
+}
+
+func TestFindFingerprints(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, db database.Client) {
+		ctx := context.Background()
+		user := createUser(t, db)
+		kept := createVideo(t, db, database.CreateVideoParams{Title: "Kept", UserID: user.ID})
+		trashed := createVideo(t, db, database.CreateVideoParams{Title: "Trashed", UserID: user.ID})
+		for _, v := range []database.Video{kept, trashed} {
+			err := db.SaveFingerprint(ctx, database.Fingerprint{
+				VideoID:     v.ID,
+				UserID:      user.ID,
+				ContentHash: "same",
+				FrameHashes: []uint64{1, 2, 3},
+				Duration:    60,
+			})
+			if err != nil {
+				t.Fatalf("SaveFingerprint() error = %v", err)
+			}
+		}
+		if err := db.TrashVideo(ctx, trashed.ID); err != nil {
+			t.Fatalf("TrashVideo() error = %v", err)
+		}
+
+		found, err := db.FindFingerprints(ctx, database.FingerprintFilter{ContentHash: "same"})
+		if err != nil {
+			t.Fatalf("FindFingerprints() error = %v", err)
+		}
+		if len(found) != 1 || found[0].VideoID != kept.ID {
+			t.Fatalf("FindFingerprints() = %d fingerprints, want only the untrashed video's", len(found))
+		}
+		if want := []uint64{1, 2, 3}; len(found[0].FrameHashes) != len(want) || found[0].FrameHashes[2] != want[2] {
+			t.Errorf("FindFingerprints() frame hashes = %v, want %v", found[0].FrameHashes, want)
+		}
+	})
+}
@@ -0,0 +1,157 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type dialect string
+
+const (
+	dialectSQLite   dialect = "sqlite"
+	dialectPostgres dialect = "postgres"
+)
+
+// dialectFor picks the database from the connection string's scheme. Anything
+// that isn't a postgres:// URL is treated as a SQLite path.
+func dialectFor(dsn string) (dialect, string) {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		return dialectPostgres, dsn
+	}
+	// SQLite leaves foreign keys off unless each connection turns them on,
+	// which the driver does for every connection opened with this option.
+	dsn = strings.TrimPrefix(dsn, "sqlite://")
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	return dialectSQLite, dsn + sep + "_foreign_keys=on"
+}
+
+func (d dialect) driverName() string {
+	if d == dialectPostgres {
+		return "postgres"
+	}
+	return "sqlite3"
+}
+
+// conn wraps *sql.DB so queries can be written once with ? placeholders and
+// rewritten to $1, $2, ... for Postgres.
+type conn struct {
+	*sql.DB
+	dialect dialect
+}
+
+func (c *conn) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return c.DB.Exec(c.dialect.rebind(query, args), args...)
+}
+
+func (c *conn) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return c.DB.Query(c.dialect.rebind(query, args), args...)
+}
+
+func (c *conn) QueryRow(query string, args ...interface{}) *sql.Row {
+	return c.DB.QueryRow(c.dialect.rebind(query, args), args...)
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return c.DB.ExecContext(ctx, c.dialect.rebind(query, args), args...)
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return c.DB.QueryContext(ctx, c.dialect.rebind(query, args), args...)
+}
+
+func (c *conn) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return c.DB.QueryRowContext(ctx, c.dialect.rebind(query, args), args...)
+}
+
+func (c *conn) Begin() (*tx, error) {
+	return c.BeginTx(context.Background(), nil)
+}
+
+func (c *conn) BeginTx(ctx context.Context, opts *sql.TxOptions) (*tx, error) {
+	t, err := c.DB.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &tx{Tx: t, dialect: c.dialect}, nil
+}
+
+type tx struct {
+	*sql.Tx
+	dialect dialect
+}
+
+func (t *tx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return t.Tx.Exec(t.dialect.rebind(query, args), args...)
+}
+
+func (t *tx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return t.Tx.ExecContext(ctx, t.dialect.rebind(query, args), args...)
+}
+
+func (t *tx) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return t.Tx.QueryContext(ctx, t.dialect.rebind(query, args), args...)
+}
+
+func (t *tx) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return t.Tx.QueryRowContext(ctx, t.dialect.rebind(query, args), args...)
+}
+
+// rebind rewrites ? placeholders outside of string literals for Postgres.
+// Queries without arguments, such as migration scripts, are left alone.
+func (d dialect) rebind(query string, args []interface{}) string {
+	if d != dialectPostgres || len(args) == 0 {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n := 0
+	inString := false
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case ch == '\'':
+			inString = !inString
+			b.WriteByte(ch)
+		case ch == '?' && !inString:
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	return b.String()
+}
+
+// timestamp converts t into a query argument that compares correctly with
+// timestamp columns. SQLite stores CURRENT_TIMESTAMP as text in UTC.
+func (d dialect) timestamp(t time.Time) interface{} {
+	if d == dialectPostgres {
+		return t
+	}
+	return t.UTC().Format("2006-01-02 15:04:05")
+}
+
+func (d dialect) nullTimestamp(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return d.timestamp(*t)
+}
+
+// forUpdate is appended to a SELECT in a transaction to lock the rows it
+// reads until the transaction ends. SQLite has no row locks, but it only
+// allows one writer at a time, so it goes without.
+func (d dialect) forUpdate() string {
+	if d == dialectPostgres {
+		return " FOR UPDATE"
+	}
+	return ""
+}
@@ -0,0 +1,136 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Fingerprint identifies the content of an uploaded video so re-uploads of
+// the same clip can be detected.
+type Fingerprint struct {
+	VideoID     uuid.UUID `json:"video_id"`
+	UserID      uuid.UUID `json:"user_id"`
+	CreatedAt   time.Time `json:"created_at"`
+	ContentHash string    `json:"content_hash"`
+	FrameHashes []uint64  `json:"frame_hashes"`
+	Duration    float64   `json:"duration"`
+}
+
+// FingerprintFilter narrows a fingerprint lookup. A uuid.Nil UserID searches
+// every user's videos.
+type FingerprintFilter struct {
+	UserID         uuid.UUID
+	ExcludeVideoID uuid.UUID
+	ContentHash    string
+	MinDuration    float64
+	MaxDuration    float64
+}
+
+func (c Client) SaveFingerprint(ctx context.Context, fp Fingerprint) error {
+	query := `
+	INSERT INTO video_fingerprints (
+		video_id,
+		user_id,
+		created_at,
+		content_hash,
+		frame_hashes,
+		duration
+	) VALUES (?, ?, CURRENT_TIMESTAMP, ?, ?, ?)
+	ON CONFLICT (video_id) DO UPDATE SET
+		created_at = CURRENT_TIMESTAMP,
+		content_hash = excluded.content_hash,
+		frame_hashes = excluded.frame_hashes,
+		duration = excluded.duration
+	`
+	_, err := c.db.ExecContext(ctx, query, fp.VideoID, fp.UserID, fp.ContentHash, encodeFrameHashes(fp.FrameHashes), fp.Duration)
+	return err
+}
+
+// FindFingerprints returns fingerprints matching the content hash when one
+// is given, otherwise those whose duration falls in the filter's range.
+// Fingerprints of trashed videos are left out.
+func (c Client) FindFingerprints(ctx context.Context, filter FingerprintFilter) ([]Fingerprint, error) {
+	query := `
+	SELECT
+		video_fingerprints.video_id,
+		video_fingerprints.user_id,
+		video_fingerprints.created_at,
+		video_fingerprints.content_hash,
+		video_fingerprints.frame_hashes,
+		video_fingerprints.duration
+	FROM video_fingerprints
+	JOIN videos ON videos.id = video_fingerprints.video_id
+	WHERE video_fingerprints.video_id != ? AND videos.deleted_at IS NULL
+	`
+	args := []interface{}{filter.ExcludeVideoID}
+	if filter.UserID != uuid.Nil {
+		query += " AND video_fingerprints.user_id = ?"
+		args = append(args, filter.UserID)
+	}
+	if filter.ContentHash != "" {
+		query += " AND video_fingerprints.content_hash = ?"
+		args = append(args, filter.ContentHash)
+	} else {
+		query += " AND video_fingerprints.duration BETWEEN ? AND ?"
+		args = append(args, filter.MinDuration, filter.MaxDuration)
+	}
+	query += " ORDER BY video_fingerprints.created_at"
+
+	rows, err := c.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	fingerprints := []Fingerprint{}
+	for rows.Next() {
+		var fp Fingerprint
+		var frameHashes string
+		if err := rows.Scan(
+			&fp.VideoID,
+			&fp.UserID,
+			&fp.CreatedAt,
+			&fp.ContentHash,
+			&frameHashes,
+			&fp.Duration,
+		); err != nil {
+			return nil, err
+		}
+		fp.FrameHashes, err = decodeFrameHashes(frameHashes)
+		if err != nil {
+			return nil, err
+		}
+		fingerprints = append(fingerprints, fp)
+	}
+
+	return fingerprints, rows.Err()
+}
+
+func encodeFrameHashes(hashes []uint64) string {
+	parts := make([]string, len(hashes))
+	for i, h := range hashes {
+		parts[i] = strconv.FormatUint(h, 16)
+	}
+	return strings.Join(parts, ",")
+}
+
+func decodeFrameHashes(s string) ([]uint64, error) {
+	if s == "" {
+		return []uint64{}, nil
+	}
+	parts := strings.Split(s, ",")
+	hashes := make([]uint64, len(parts))
+	for i, p := range parts {
+		h, err := strconv.ParseUint(p, 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid frame hash %q: %w", p, err)
+		}
+		hashes[i] = h
+	}
+	return hashes, nil
+}
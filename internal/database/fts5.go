@@ -0,0 +1,8 @@
+//go:build !sqlite_fts5
+
+package database
+
+// Video search creates an FTS5 table in its migration, which SQLite only
+// has when the driver is built with the sqlite_fts5 tag. Without it the
+// server would build and then fail to migrate, so refuse to build instead.
+var _ = build_with_tags_sqlite_fts5
@@ -0,0 +1,1579 @@
+// Package memstore is an in-memory database.Store for handler tests.
+package memstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+type Store struct {
+	mu            sync.Mutex
+	users         map[uuid.UUID]database.User
+	videos        map[uuid.UUID]database.Video
+	captions      map[uuid.UUID]map[string]database.Caption
+	chapters      map[uuid.UUID][]database.Chapter
+	fingerprints  map[uuid.UUID]database.Fingerprint
+	revisions     map[uuid.UUID][]database.VideoRevision
+	sessions      map[playbackKey]playbackSession
+	dailyStats    map[uuid.UUID]map[string]database.VideoDailyStats
+	comments      map[uuid.UUID]database.Comment
+	reactions     map[reactionKey]string
+	playlists     map[uuid.UUID]database.Playlist
+	playlistItems map[uuid.UUID][]playlistItem
+	webhooks      map[uuid.UUID]database.WebhookDelivery
+	refreshTokens map[uuid.UUID]database.RefreshToken
+	authSessions  map[uuid.UUID]authSession
+}
+
+// playlistItem is a playlist entry, kept in order in Store.playlistItems.
+type playlistItem struct {
+	id        uuid.UUID
+	createdAt time.Time
+	videoID   uuid.UUID
+}
+
+type playbackKey struct {
+	videoID   uuid.UUID
+	sessionID string
+}
+
+// authSession is a database.Session with the revocation time it doesn't
+// expose.
+type authSession struct {
+	database.Session
+	revokedAt *time.Time
+}
+
+type reactionKey struct {
+	videoID uuid.UUID
+	userID  uuid.UUID
+}
+
+type playbackSession struct {
+	database.PlaybackSession
+	day string
+}
+
+var _ database.Store = (*Store)(nil)
+
+func New() *Store {
+	s := &Store{}
+	s.reset()
+	return s
+}
+
+func (s *Store) reset() {
+	s.users = map[uuid.UUID]database.User{}
+	s.videos = map[uuid.UUID]database.Video{}
+	s.captions = map[uuid.UUID]map[string]database.Caption{}
+	s.chapters = map[uuid.UUID][]database.Chapter{}
+	s.fingerprints = map[uuid.UUID]database.Fingerprint{}
+	s.revisions = map[uuid.UUID][]database.VideoRevision{}
+	s.sessions = map[playbackKey]playbackSession{}
+	s.dailyStats = map[uuid.UUID]map[string]database.VideoDailyStats{}
+	s.comments = map[uuid.UUID]database.Comment{}
+	s.reactions = map[reactionKey]string{}
+	s.playlists = map[uuid.UUID]database.Playlist{}
+	s.playlistItems = map[uuid.UUID][]playlistItem{}
+	s.webhooks = map[uuid.UUID]database.WebhookDelivery{}
+	s.refreshTokens = map[uuid.UUID]database.RefreshToken{}
+	s.authSessions = map[uuid.UUID]authSession{}
+}
+
+func (s *Store) Reset(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reset()
+	return nil
+}
+
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
+}
+
+// Users
+
+func (s *Store) GetUsers(ctx context.Context) ([]database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	users := []database.User{}
+	for _, user := range s.users {
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+func (s *Store) GetUser(ctx context.Context, id uuid.UUID) (*database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return nil, database.ErrNotFound
+	}
+	return &user, nil
+}
+
+func (s *Store) GetUserByEmail(ctx context.Context, email string) (database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, user := range s.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return database.User{}, database.ErrNotFound
+}
+
+func (s *Store) CreateUser(ctx context.Context, params database.CreateUserParams) (*database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, user := range s.users {
+		if user.Email == params.Email {
+			return nil, database.ErrConflict
+		}
+	}
+	user := database.User{
+		ID:               uuid.New(),
+		CreatedAt:        now(),
+		UpdatedAt:        now(),
+		CreateUserParams: params,
+	}
+	s.users[user.ID] = user
+	return &user, nil
+}
+
+func (s *Store) UpdateUserPassword(ctx context.Context, id uuid.UUID, password string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return database.ErrNotFound
+	}
+	user.Password = password
+	user.TokenVersion++
+	user.UpdatedAt = now()
+	s.users[id] = user
+	return nil
+}
+
+func (s *Store) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[id]; !ok {
+		return database.ErrNotFound
+	}
+	delete(s.users, id)
+	return nil
+}
+
+// Videos
+
+func (s *Store) GetVideos(ctx context.Context, params database.GetVideosParams) (database.VideoPage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	videos := []database.Video{}
+	for _, video := range s.videos {
+		if matchesVideoFilters(video, params) {
+			videos = append(videos, video)
+		}
+	}
+
+	sortBy := params.Sort
+	descending := params.Descending
+	if sortBy == "" {
+		sortBy = database.VideoSortCreatedAt
+		descending = true
+	}
+	sort.Slice(videos, func(i, j int) bool {
+		a := database.VideoSortValue(videos[i], sortBy)
+		b := database.VideoSortValue(videos[j], sortBy)
+		if a == b {
+			a, b = videos[i].ID.String(), videos[j].ID.String()
+		}
+		if descending {
+			return a > b
+		}
+		return a < b
+	})
+	return database.PageVideos(videos, params)
+}
+
+func matchesVideoFilters(video database.Video, params database.GetVideosParams) bool {
+	if video.DeletedAt != nil {
+		return false
+	}
+	if params.UserID != uuid.Nil && video.UserID != params.UserID {
+		return false
+	}
+	if params.Visibility != "" && video.Visibility != params.Visibility {
+		return false
+	}
+	if params.HasVideo != nil && (video.VideoURL != nil) != *params.HasVideo {
+		return false
+	}
+	if params.HasThumbnail != nil && (video.ThumbnailURL != nil) != *params.HasThumbnail {
+		return false
+	}
+	if params.AspectRatio != "" && (video.AspectRatio == nil || *video.AspectRatio != params.AspectRatio) {
+		return false
+	}
+	if params.ProcessingStatus != "" && video.ProcessingStatus != params.ProcessingStatus {
+		return false
+	}
+	if params.CreatedAfter != nil && video.CreatedAt.Before(*params.CreatedAfter) {
+		return false
+	}
+	if params.CreatedBefore != nil && !video.CreatedAt.Before(*params.CreatedBefore) {
+		return false
+	}
+	if params.Tag != "" && !slices.Contains(video.Tags, params.Tag) {
+		return false
+	}
+	return true
+}
+
+func (s *Store) GetVideosWithOriginals(ctx context.Context) ([]database.Video, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	videos := []database.Video{}
+	for _, video := range s.videos {
+		if video.OriginalKey != nil && video.DeletedAt == nil {
+			videos = append(videos, video)
+		}
+	}
+	sort.Slice(videos, func(i, j int) bool {
+		return videos[i].CreatedAt.Before(videos[j].CreatedAt)
+	})
+	return videos, nil
+}
+
+func (s *Store) GetVideo(ctx context.Context, id uuid.UUID) (database.Video, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	video, ok := s.videos[id]
+	if !ok || video.DeletedAt != nil {
+		return database.Video{}, database.ErrNotFound
+	}
+	return video, nil
+}
+
+func (s *Store) CreateVideo(ctx context.Context, params database.CreateVideoParams) (database.Video, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	video := database.Video{
+		ID:                uuid.New(),
+		CreatedAt:         now(),
+		UpdatedAt:         now(),
+		Version:           1,
+		ProcessingStatus:  database.ProcessingStatusPending,
+		CreateVideoParams: params,
+	}
+	if video.Visibility == "" {
+		video.Visibility = database.VisibilityPrivate
+	}
+	video.Tags = sortedTags(params.Tags)
+	video.Reactions = map[string]int{}
+	for _, reaction := range database.Reactions {
+		video.Reactions[reaction] = 0
+	}
+	s.videos[video.ID] = video
+	return video, nil
+}
+
+func (s *Store) UpdateVideo(ctx context.Context, video database.Video) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.videos[video.ID]
+	if !ok {
+		return database.ErrNotFound
+	}
+	video.CreatedAt = existing.CreatedAt
+	video.UpdatedAt = now()
+	video.Version = existing.Version + 1
+	video.Tags = existing.Tags
+	video.Reactions = existing.Reactions
+	s.videos[video.ID] = video
+	return nil
+}
+
+func (s *Store) UpdateVideoMetadata(ctx context.Context, id uuid.UUID, params database.UpdateVideoMetadataParams) (database.Video, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	video, ok := s.videos[id]
+	if !ok || video.DeletedAt != nil {
+		return database.Video{}, database.ErrNotFound
+	}
+	if params.IfVersion != nil && *params.IfVersion != video.Version {
+		return database.Video{}, database.ErrModified
+	}
+
+	before := video
+	video.UpdatedAt = now()
+	video.Version++
+	if params.Title != nil {
+		video.Title = *params.Title
+	}
+	if params.Description != nil {
+		video.Description = *params.Description
+	}
+	s.videos[id] = video
+	s.addRevisions(before, video, params.UserID, nil)
+	return video, nil
+}
+
+func (s *Store) UpdateVideoVisibility(ctx context.Context, id uuid.UUID, params database.UpdateVideoVisibilityParams) (database.Video, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	video, ok := s.videos[id]
+	if !ok || video.DeletedAt != nil {
+		return database.Video{}, database.ErrNotFound
+	}
+	if params.IfVersion != nil && *params.IfVersion != video.Version {
+		return database.Video{}, database.ErrModified
+	}
+
+	before := video
+	video.UpdatedAt = now()
+	video.Version++
+	video.Visibility = params.Visibility
+	video.PublishAt = params.PublishAt
+	s.videos[id] = video
+	s.addRevisions(before, video, params.UserID, nil)
+	return video, nil
+}
+
+func (s *Store) ReviseVideoFile(ctx context.Context, video database.Video, userID uuid.UUID) (database.Video, error) {
+	return s.reviseVideo(database.RevisionKindVideo, video, userID)
+}
+
+func (s *Store) ReviseVideoThumbnail(ctx context.Context, video database.Video, userID uuid.UUID) (database.Video, error) {
+	return s.reviseVideo(database.RevisionKindThumbnail, video, userID)
+}
+
+func (s *Store) reviseVideo(kind string, video database.Video, userID uuid.UUID) (database.Video, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	before, ok := s.videos[video.ID]
+	if !ok || before.DeletedAt != nil {
+		return database.Video{}, database.ErrNotFound
+	}
+	after := before
+	database.CopyVideoFields(kind, &after, video)
+	after.UpdatedAt = now()
+	after.Version++
+	s.videos[video.ID] = after
+	s.addRevisions(before, after, userID, nil)
+	return after, nil
+}
+
+func (s *Store) GetVideoRevisions(ctx context.Context, videoID uuid.UUID) ([]database.VideoRevision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	revisions := slices.Clone(s.revisions[videoID])
+	slices.Reverse(revisions)
+	if revisions == nil {
+		revisions = []database.VideoRevision{}
+	}
+	return revisions, nil
+}
+
+func (s *Store) RollbackVideoRevision(ctx context.Context, videoID, revisionID, userID uuid.UUID) (database.Video, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := slices.IndexFunc(s.revisions[videoID], func(revision database.VideoRevision) bool {
+		return revision.ID == revisionID
+	})
+	if i == -1 {
+		return database.Video{}, database.ErrNotFound
+	}
+	revision := s.revisions[videoID][i]
+	if !database.IsMediaRevision(revision) {
+		return database.Video{}, database.ErrNotMediaRevision
+	}
+
+	before, ok := s.videos[videoID]
+	if !ok || before.DeletedAt != nil {
+		return database.Video{}, database.ErrNotFound
+	}
+	video := before
+	if err := database.ApplyRevision(&video, revision); err != nil {
+		return database.Video{}, err
+	}
+	video.UpdatedAt = now()
+	video.Version++
+	s.videos[videoID] = video
+	s.addRevisions(before, video, userID, &revision.ID)
+	return video, nil
+}
+
+func (s *Store) addRevisions(before, after database.Video, userID uuid.UUID, rollbackOf *uuid.UUID) {
+	var author *uuid.UUID
+	if userID != uuid.Nil {
+		author = &userID
+	}
+	for _, kind := range database.RevisionKinds {
+		changes := database.RevisionChanges(kind, before, after)
+		if changes == nil {
+			continue
+		}
+		s.revisions[after.ID] = append(s.revisions[after.ID], database.VideoRevision{
+			ID:         uuid.New(),
+			CreatedAt:  now(),
+			VideoID:    after.ID,
+			Number:     len(s.revisions[after.ID]) + 1,
+			Kind:       kind,
+			Changes:    changes,
+			RollbackOf: rollbackOf,
+			UserID:     author,
+		})
+	}
+}
+
+func (s *Store) SetVideoProcessingStatus(ctx context.Context, id uuid.UUID, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	video, ok := s.videos[id]
+	if !ok {
+		return database.ErrNotFound
+	}
+	video.ProcessingStatus = status
+	video.Version++
+	s.videos[id] = video
+	return nil
+}
+
+func (s *Store) DeleteVideo(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.videos[id]; !ok {
+		return database.ErrNotFound
+	}
+	delete(s.captions, id)
+	delete(s.chapters, id)
+	delete(s.fingerprints, id)
+	delete(s.revisions, id)
+	delete(s.dailyStats, id)
+	for commentID, comment := range s.comments {
+		if comment.VideoID == id {
+			delete(s.comments, commentID)
+		}
+	}
+	for key := range s.sessions {
+		if key.videoID == id {
+			delete(s.sessions, key)
+		}
+	}
+	for key := range s.reactions {
+		if key.videoID == id {
+			delete(s.reactions, key)
+		}
+	}
+	s.removeFromPlaylists(id)
+	delete(s.videos, id)
+	return nil
+}
+
+func (s *Store) removeFromPlaylists(videoID uuid.UUID) {
+	for playlistID, items := range s.playlistItems {
+		s.playlistItems[playlistID] = slices.DeleteFunc(items, func(item playlistItem) bool {
+			return item.videoID == videoID
+		})
+	}
+}
+
+func (s *Store) TrashVideo(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	video, ok := s.videos[id]
+	if !ok || video.DeletedAt != nil {
+		return database.ErrNotFound
+	}
+	deletedAt := now()
+	video.DeletedAt = &deletedAt
+	video.Version++
+	s.videos[id] = video
+	return nil
+}
+
+func (s *Store) RestoreVideo(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	video, ok := s.videos[id]
+	if !ok || video.DeletedAt == nil {
+		return database.ErrNotFound
+	}
+	video.DeletedAt = nil
+	video.UpdatedAt = now()
+	s.videos[id] = video
+	return nil
+}
+
+func (s *Store) GetTrashedVideo(ctx context.Context, id uuid.UUID) (database.Video, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	video, ok := s.videos[id]
+	if !ok || video.DeletedAt == nil {
+		return database.Video{}, database.ErrNotFound
+	}
+	return video, nil
+}
+
+func (s *Store) GetTrashedVideos(ctx context.Context, userID uuid.UUID) ([]database.Video, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	videos := []database.Video{}
+	for _, video := range s.videos {
+		if video.UserID == userID && video.DeletedAt != nil {
+			videos = append(videos, video)
+		}
+	}
+	sort.Slice(videos, func(i, j int) bool {
+		return videos[i].DeletedAt.After(*videos[j].DeletedAt)
+	})
+	return videos, nil
+}
+
+func (s *Store) GetVideosTrashedBefore(ctx context.Context, before time.Time) ([]database.Video, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	videos := []database.Video{}
+	for _, video := range s.videos {
+		if video.DeletedAt != nil && video.DeletedAt.Before(before) {
+			videos = append(videos, video)
+		}
+	}
+	sort.Slice(videos, func(i, j int) bool {
+		return videos[i].DeletedAt.Before(*videos[j].DeletedAt)
+	})
+	return videos, nil
+}
+
+// SearchVideos matches the same terms as Client, scoring title matches
+// above description matches.
+func (s *Store) SearchVideos(ctx context.Context, params database.SearchVideosParams) (database.VideoSearchPage, error) {
+	terms := database.SearchTerms(params.Query)
+	if len(terms) == 0 {
+		return database.VideoSearchPage{}, database.ErrEmptySearch
+	}
+	if params.Limit <= 0 {
+		params.Limit = database.DefaultVideoPageSize
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	results := []database.VideoSearchResult{}
+	for _, video := range s.videos {
+		if video.UserID != params.UserID || video.DeletedAt != nil {
+			continue
+		}
+		title, titleHits := highlightTerms(video.Title, terms)
+		description, descriptionHits := highlightTerms(video.Description, terms)
+		matched := true
+		for i := range terms {
+			if titleHits[i]+descriptionHits[i] == 0 {
+				matched = false
+			}
+		}
+		if !matched {
+			continue
+		}
+		rank := 0.0
+		for i := range terms {
+			rank += 2*float64(titleHits[i]) + float64(descriptionHits[i])
+		}
+		results = append(results, database.VideoSearchResult{
+			Video:          video,
+			Rank:           rank,
+			TitleHighlight: title,
+			Snippet:        description,
+		})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Rank != results[j].Rank {
+			return results[i].Rank > results[j].Rank
+		}
+		return results[i].CreatedAt.After(results[j].CreatedAt)
+	})
+
+	page := database.VideoSearchPage{Total: len(results)}
+	if params.Offset < len(results) {
+		results = results[params.Offset:]
+	} else {
+		results = []database.VideoSearchResult{}
+	}
+	if len(results) > params.Limit {
+		results = results[:params.Limit]
+	}
+	page.Results = results
+	return page, nil
+}
+
+// highlightTerms marks the words of text matching a term, the last term as a
+// prefix, and counts the hits per term.
+func highlightTerms(text string, terms []string) (string, []int) {
+	hits := make([]int, len(terms))
+	var b strings.Builder
+	word := []rune{}
+	flush := func() {
+		if len(word) == 0 {
+			return
+		}
+		lower := strings.ToLower(string(word))
+		matched := false
+		for i, term := range terms {
+			if lower == term || (i == len(terms)-1 && strings.HasPrefix(lower, term)) {
+				hits[i]++
+				matched = true
+			}
+		}
+		if matched {
+			b.WriteString(database.HighlightStart + string(word) + database.HighlightEnd)
+		} else {
+			b.WriteString(string(word))
+		}
+		word = word[:0]
+	}
+	for _, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			word = append(word, r)
+			continue
+		}
+		flush()
+		b.WriteRune(r)
+	}
+	flush()
+	return b.String(), hits
+}
+
+// Tags
+
+func (s *Store) GetTags(ctx context.Context, params database.GetTagsParams) ([]database.TagCount, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts := map[string]int{}
+	for _, video := range s.videos {
+		if video.UserID != params.UserID || video.DeletedAt != nil {
+			continue
+		}
+		for _, tag := range video.Tags {
+			if strings.HasPrefix(tag, params.Prefix) {
+				counts[tag]++
+			}
+		}
+	}
+
+	tags := []database.TagCount{}
+	for name, count := range counts {
+		tags = append(tags, database.TagCount{Name: name, Count: count})
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Count != tags[j].Count {
+			return tags[i].Count > tags[j].Count
+		}
+		return tags[i].Name < tags[j].Name
+	})
+	if params.Limit > 0 && len(tags) > params.Limit {
+		tags = tags[:params.Limit]
+	}
+	return tags, nil
+}
+
+func (s *Store) SetVideoTags(ctx context.Context, videoID uuid.UUID, tags []string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	video, ok := s.videos[videoID]
+	if !ok {
+		return nil, database.ErrNotFound
+	}
+	video.Tags = sortedTags(tags)
+	s.videos[videoID] = video
+	return slices.Clone(video.Tags), nil
+}
+
+// sortedTags returns a sorted copy of tags without duplicates, the order
+// Client returns them in.
+func sortedTags(tags []string) []string {
+	sorted := slices.Clone(tags)
+	if sorted == nil {
+		sorted = []string{}
+	}
+	slices.Sort(sorted)
+	return slices.Compact(sorted)
+}
+
+// Playlists
+
+func (s *Store) GetPlaylists(ctx context.Context, userID uuid.UUID) ([]database.Playlist, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	playlists := []database.Playlist{}
+	for _, playlist := range s.playlists {
+		if playlist.UserID == userID {
+			playlists = append(playlists, playlist)
+		}
+	}
+	sort.Slice(playlists, func(i, j int) bool {
+		return playlists[i].CreatedAt.After(playlists[j].CreatedAt)
+	})
+	return playlists, nil
+}
+
+func (s *Store) GetPlaylist(ctx context.Context, id uuid.UUID) (database.Playlist, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	playlist, ok := s.playlists[id]
+	if !ok {
+		return database.Playlist{}, database.ErrNotFound
+	}
+	return playlist, nil
+}
+
+func (s *Store) CreatePlaylist(ctx context.Context, params database.CreatePlaylistParams) (database.Playlist, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	playlist := database.Playlist{
+		ID:                   uuid.New(),
+		CreatedAt:            now(),
+		UpdatedAt:            now(),
+		CreatePlaylistParams: params,
+	}
+	s.playlists[playlist.ID] = playlist
+	return playlist, nil
+}
+
+func (s *Store) UpdatePlaylist(ctx context.Context, playlist database.Playlist) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.playlists[playlist.ID]
+	if !ok {
+		return database.ErrNotFound
+	}
+	playlist.CreatedAt = existing.CreatedAt
+	playlist.UpdatedAt = now()
+	playlist.UserID = existing.UserID
+	s.playlists[playlist.ID] = playlist
+	return nil
+}
+
+func (s *Store) DeletePlaylist(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.playlists[id]; !ok {
+		return database.ErrNotFound
+	}
+	delete(s.playlistItems, id)
+	delete(s.playlists, id)
+	return nil
+}
+
+func (s *Store) GetPlaylistItems(ctx context.Context, playlistID uuid.UUID) ([]database.PlaylistItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items := []database.PlaylistItem{}
+	for position, item := range s.playlistItems[playlistID] {
+		if s.videos[item.videoID].DeletedAt != nil {
+			continue
+		}
+		items = append(items, database.PlaylistItem{
+			ID:         item.id,
+			CreatedAt:  item.createdAt,
+			PlaylistID: playlistID,
+			Position:   position,
+			Video:      s.videos[item.videoID],
+		})
+	}
+	return items, nil
+}
+
+func (s *Store) AddPlaylistItem(ctx context.Context, playlistID, videoID uuid.UUID, position *int) (database.PlaylistItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.playlists[playlistID]; !ok {
+		return database.PlaylistItem{}, database.ErrNotFound
+	}
+	items := s.playlistItems[playlistID]
+	for _, item := range items {
+		if item.videoID == videoID {
+			return database.PlaylistItem{}, database.ErrConflict
+		}
+	}
+
+	item := playlistItem{id: uuid.New(), createdAt: now(), videoID: videoID}
+	at := len(items)
+	if position != nil && *position < len(items) {
+		at = max(*position, 0)
+	}
+	s.playlistItems[playlistID] = slices.Insert(items, at, item)
+	s.touchPlaylist(playlistID)
+
+	return database.PlaylistItem{
+		ID:         item.id,
+		CreatedAt:  item.createdAt,
+		PlaylistID: playlistID,
+		Position:   at,
+		Video:      s.videos[videoID],
+	}, nil
+}
+
+func (s *Store) MovePlaylistItem(ctx context.Context, playlistID, itemID uuid.UUID, position int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.playlists[playlistID]; !ok {
+		return database.ErrNotFound
+	}
+	order := s.playlistOrder(playlistID)
+	from := slices.Index(order, itemID)
+	if from == -1 {
+		return database.ErrNotFound
+	}
+	s.setPlaylistOrder(playlistID, database.MovePlaylistPosition(order, from, position))
+	return nil
+}
+
+func (s *Store) ReorderPlaylistItems(ctx context.Context, playlistID uuid.UUID, itemIDs []uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.playlists[playlistID]; !ok {
+		return database.ErrNotFound
+	}
+	order := s.playlistOrder(playlistID)
+	trashed := map[uuid.UUID]bool{}
+	for _, item := range s.playlistItems[playlistID] {
+		if s.videos[item.videoID].DeletedAt != nil {
+			trashed[item.id] = true
+		}
+	}
+	visible := slices.DeleteFunc(slices.Clone(order), func(id uuid.UUID) bool {
+		return trashed[id]
+	})
+	if !database.SamePlaylistItems(visible, itemIDs) {
+		return database.ErrInvalidPlaylistOrder
+	}
+	s.setPlaylistOrder(playlistID, database.MergePlaylistOrder(order, trashed, itemIDs))
+	return nil
+}
+
+func (s *Store) RemovePlaylistItem(ctx context.Context, playlistID, itemID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items := s.playlistItems[playlistID]
+	i := slices.IndexFunc(items, func(item playlistItem) bool {
+		return item.id == itemID
+	})
+	if i == -1 {
+		return database.ErrNotFound
+	}
+	s.playlistItems[playlistID] = slices.Delete(items, i, i+1)
+	s.touchPlaylist(playlistID)
+	return nil
+}
+
+func (s *Store) playlistOrder(playlistID uuid.UUID) []uuid.UUID {
+	order := []uuid.UUID{}
+	for _, item := range s.playlistItems[playlistID] {
+		order = append(order, item.id)
+	}
+	return order
+}
+
+func (s *Store) setPlaylistOrder(playlistID uuid.UUID, order []uuid.UUID) {
+	byID := map[uuid.UUID]playlistItem{}
+	for _, item := range s.playlistItems[playlistID] {
+		byID[item.id] = item
+	}
+	items := make([]playlistItem, 0, len(order))
+	for _, id := range order {
+		items = append(items, byID[id])
+	}
+	s.playlistItems[playlistID] = items
+	s.touchPlaylist(playlistID)
+}
+
+func (s *Store) touchPlaylist(playlistID uuid.UUID) {
+	playlist := s.playlists[playlistID]
+	playlist.UpdatedAt = now()
+	s.playlists[playlistID] = playlist
+}
+
+// Publishing
+
+func (s *Store) PublishDueVideos(ctx context.Context, now time.Time, webhookURLs []string) ([]database.Video, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	videos := []database.Video{}
+	for id, video := range s.videos {
+		if video.PublishAt == nil || video.PublishAt.After(now) || video.DeletedAt != nil {
+			continue
+		}
+		video.UpdatedAt = now.UTC().Truncate(time.Second)
+		video.Visibility = database.VisibilityPublic
+		video.PublishAt = nil
+		video.Version++
+		s.videos[id] = video
+		videos = append(videos, video)
+
+		payload, err := json.Marshal(database.WebhookPayload{
+			Event: database.WebhookEventVideoPublished,
+			Video: video,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, url := range webhookURLs {
+			delivery := database.WebhookDelivery{
+				ID:            uuid.New(),
+				CreatedAt:     now,
+				Event:         database.WebhookEventVideoPublished,
+				URL:           url,
+				Payload:       string(payload),
+				NextAttemptAt: &now,
+			}
+			s.webhooks[delivery.ID] = delivery
+		}
+	}
+	return videos, nil
+}
+
+func (s *Store) GetDueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]database.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deliveries := []database.WebhookDelivery{}
+	for _, delivery := range s.webhooks {
+		if delivery.NextAttemptAt != nil && !delivery.NextAttemptAt.After(now) {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].NextAttemptAt.Before(*deliveries[j].NextAttemptAt)
+	})
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
+
+func (s *Store) MarkWebhookDelivered(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delivery, ok := s.webhooks[id]
+	if !ok {
+		return database.ErrNotFound
+	}
+	deliveredAt := now()
+	delivery.Attempts++
+	delivery.NextAttemptAt = nil
+	delivery.DeliveredAt = &deliveredAt
+	delivery.LastError = nil
+	s.webhooks[id] = delivery
+	return nil
+}
+
+func (s *Store) MarkWebhookFailed(ctx context.Context, id uuid.UUID, lastError string, nextAttemptAt *time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delivery, ok := s.webhooks[id]
+	if !ok {
+		return database.ErrNotFound
+	}
+	delivery.Attempts++
+	delivery.NextAttemptAt = nextAttemptAt
+	delivery.LastError = &lastError
+	s.webhooks[id] = delivery
+	return nil
+}
+
+// Captions
+
+func (s *Store) GetCaption(ctx context.Context, videoID uuid.UUID, language string) (database.Caption, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	caption, ok := s.captions[videoID][language]
+	if !ok {
+		return database.Caption{}, database.ErrNotFound
+	}
+	return caption, nil
+}
+
+func (s *Store) GetCaptions(ctx context.Context, videoID uuid.UUID) ([]database.Caption, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	captions := []database.Caption{}
+	for _, caption := range s.captions[videoID] {
+		captions = append(captions, caption)
+	}
+	sort.Slice(captions, func(i, j int) bool {
+		return captions[i].Language < captions[j].Language
+	})
+	return captions, nil
+}
+
+func (s *Store) UpsertCaption(ctx context.Context, params database.CreateCaptionParams) (database.Caption, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.captions[params.VideoID] == nil {
+		s.captions[params.VideoID] = map[string]database.Caption{}
+	}
+	caption, ok := s.captions[params.VideoID][params.Language]
+	if !ok {
+		caption.ID = uuid.New()
+		caption.CreatedAt = now()
+	}
+	caption.UpdatedAt = now()
+	caption.CreateCaptionParams = params
+	s.captions[params.VideoID][params.Language] = caption
+	return caption, nil
+}
+
+func (s *Store) DeleteCaption(ctx context.Context, videoID uuid.UUID, language string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.captions[videoID][language]; !ok {
+		return database.ErrNotFound
+	}
+	delete(s.captions[videoID], language)
+	return nil
+}
+
+// Chapters
+
+func (s *Store) GetChapters(ctx context.Context, videoID uuid.UUID) ([]database.Chapter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]database.Chapter{}, s.chapters[videoID]...), nil
+}
+
+func (s *Store) ReplaceChapters(ctx context.Context, videoID uuid.UUID, params []database.CreateChapterParams) ([]database.Chapter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	chapters := make([]database.Chapter, 0, len(params))
+	for _, p := range params {
+		chapters = append(chapters, database.Chapter{
+			ID:                  uuid.New(),
+			VideoID:             videoID,
+			CreateChapterParams: p,
+		})
+	}
+	sort.SliceStable(chapters, func(i, j int) bool {
+		return chapters[i].StartTime < chapters[j].StartTime
+	})
+	s.chapters[videoID] = chapters
+	return append([]database.Chapter{}, chapters...), nil
+}
+
+// Fingerprints
+
+func (s *Store) SaveFingerprint(ctx context.Context, fp database.Fingerprint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fp.CreatedAt = now()
+	s.fingerprints[fp.VideoID] = fp
+	return nil
+}
+
+func (s *Store) FindFingerprints(ctx context.Context, filter database.FingerprintFilter) ([]database.Fingerprint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fingerprints := []database.Fingerprint{}
+	for _, fp := range s.fingerprints {
+		if fp.VideoID == filter.ExcludeVideoID || s.videos[fp.VideoID].DeletedAt != nil {
+			continue
+		}
+		if filter.UserID != uuid.Nil && fp.UserID != filter.UserID {
+			continue
+		}
+		if filter.ContentHash != "" {
+			if fp.ContentHash != filter.ContentHash {
+				continue
+			}
+		} else if fp.Duration < filter.MinDuration || fp.Duration > filter.MaxDuration {
+			continue
+		}
+		fingerprints = append(fingerprints, fp)
+	}
+	sort.Slice(fingerprints, func(i, j int) bool {
+		return fingerprints[i].CreatedAt.Before(fingerprints[j].CreatedAt)
+	})
+	return fingerprints, nil
+}
+
+// Refresh tokens
+
+func (s *Store) GetRefreshToken(ctx context.Context, id uuid.UUID) (database.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rt, ok := s.refreshTokens[id]
+	if !ok {
+		return database.RefreshToken{}, database.ErrNotFound
+	}
+	return rt, nil
+}
+
+func (s *Store) CreateRefreshToken(ctx context.Context, params database.CreateRefreshTokenParams) (database.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if params.FamilyID == uuid.Nil {
+		params.FamilyID = uuid.New()
+		s.authSessions[params.FamilyID] = authSession{
+			Session: database.Session{
+				ID:         params.FamilyID,
+				CreatedAt:  now(),
+				LastUsedAt: now(),
+				ExpiresAt:  params.ExpiresAt,
+				UserID:     params.UserID,
+				UserAgent:  params.UserAgent,
+				IP:         params.IP,
+			},
+		}
+	}
+	rt := database.RefreshToken{
+		CreateRefreshTokenParams: params,
+		CreatedAt:                now(),
+		UpdatedAt:                now(),
+	}
+	s.refreshTokens[params.ID] = rt
+	return rt, nil
+}
+
+func (s *Store) RotateRefreshToken(ctx context.Context, id uuid.UUID, params database.CreateRefreshTokenParams) (database.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, ok := s.refreshTokens[id]
+	if !ok {
+		return database.RefreshToken{}, database.ErrNotFound
+	}
+	err := database.CheckRefreshToken(old, time.Now())
+	if errors.Is(err, database.ErrTokenReused) {
+		s.revokeSession(old.FamilyID)
+		return database.RefreshToken{}, err
+	}
+	if err != nil {
+		return database.RefreshToken{}, err
+	}
+
+	revokedAt := now()
+	old.RevokedAt = &revokedAt
+	old.UpdatedAt = revokedAt
+	old.ReplacedBy = &params.ID
+	s.refreshTokens[id] = old
+
+	params.UserID = old.UserID
+	params.FamilyID = old.FamilyID
+	rt := database.RefreshToken{
+		CreateRefreshTokenParams: params,
+		CreatedAt:                now(),
+		UpdatedAt:                now(),
+	}
+	s.refreshTokens[params.ID] = rt
+	if session, ok := s.authSessions[params.FamilyID]; ok {
+		session.LastUsedAt = now()
+		session.ExpiresAt = params.ExpiresAt
+		session.UserAgent = params.UserAgent
+		session.IP = params.IP
+		s.authSessions[params.FamilyID] = session
+	}
+	return rt, nil
+}
+
+func (s *Store) RevokeRefreshToken(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rt, ok := s.refreshTokens[id]
+	if !ok {
+		return database.ErrNotFound
+	}
+	s.revokeSession(rt.FamilyID)
+	return nil
+}
+
+func (s *Store) DeleteRefreshToken(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.refreshTokens[id]; !ok {
+		return database.ErrNotFound
+	}
+	delete(s.refreshTokens, id)
+	return nil
+}
+
+// Sessions
+
+func (s *Store) GetSessions(ctx context.Context, userID uuid.UUID) ([]database.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sessions := []database.Session{}
+	for _, session := range s.authSessions {
+		if session.UserID == userID && session.revokedAt == nil && time.Now().Before(session.ExpiresAt) {
+			sessions = append(sessions, session.Session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt)
+	})
+	return sessions, nil
+}
+
+func (s *Store) RevokeSession(ctx context.Context, userID, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.authSessions[id]
+	if !ok || session.UserID != userID || session.revokedAt != nil {
+		return database.ErrNotFound
+	}
+	s.revokeSession(id)
+	return nil
+}
+
+func (s *Store) RevokeSessions(ctx context.Context, userID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, session := range s.authSessions {
+		if session.UserID == userID {
+			s.revokeSession(id)
+		}
+	}
+	return nil
+}
+
+func (s *Store) revokeSession(id uuid.UUID) {
+	revokedAt := now()
+	if session, ok := s.authSessions[id]; ok && session.revokedAt == nil {
+		session.revokedAt = &revokedAt
+		s.authSessions[id] = session
+	}
+	for tokenID, rt := range s.refreshTokens {
+		if rt.FamilyID == id && rt.RevokedAt == nil {
+			rt.RevokedAt = &revokedAt
+			rt.UpdatedAt = revokedAt
+			s.refreshTokens[tokenID] = rt
+		}
+	}
+}
+
+func (s *Store) RecordPlaybackEvent(ctx context.Context, event database.PlaybackEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := playbackKey{videoID: event.VideoID, sessionID: event.SessionID}
+	session, ok := s.sessions[key]
+	stats := database.ApplyPlaybackEvent(&session.PlaybackSession, !ok, event)
+	if !ok {
+		session.day = stats.Day
+	}
+	s.sessions[key] = session
+
+	if s.dailyStats[event.VideoID] == nil {
+		s.dailyStats[event.VideoID] = map[string]database.VideoDailyStats{}
+	}
+	day := s.dailyStats[event.VideoID][stats.Day]
+	day.Day = stats.Day
+	day.Views += stats.Views
+	day.WatchTime += stats.WatchTime
+	day.Completions += stats.Completions
+	s.dailyStats[event.VideoID][stats.Day] = day
+	return nil
+}
+
+func (s *Store) GetVideoDailyStats(ctx context.Context, videoID uuid.UUID, from, to time.Time) ([]database.VideoDailyStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	first, last := from.UTC().Format(database.StatsDayLayout), to.UTC().Format(database.StatsDayLayout)
+	days := []database.VideoDailyStats{}
+	for day, stats := range s.dailyStats[videoID] {
+		if day >= first && day <= last {
+			days = append(days, stats)
+		}
+	}
+	sort.Slice(days, func(i, j int) bool {
+		return days[i].Day < days[j].Day
+	})
+	return days, nil
+}
+
+func (s *Store) GetPlaybackPositions(ctx context.Context, videoID uuid.UUID, from, to time.Time) ([]float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	first, last := from.UTC().Format(database.StatsDayLayout), to.UTC().Format(database.StatsDayLayout)
+	positions := []float64{}
+	for key, session := range s.sessions {
+		if key.videoID == videoID && session.day >= first && session.day <= last {
+			positions = append(positions, session.MaxPosition)
+		}
+	}
+	return positions, nil
+}
+
+func (s *Store) CreateComment(ctx context.Context, params database.CreateCommentParams, limits ...database.CommentRateLimit) (database.Comment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, limit := range limits {
+		since := now().Add(-limit.Window)
+		count := 0
+		for _, comment := range s.comments {
+			if comment.UserID == params.UserID && comment.CreatedAt.After(since) {
+				count++
+			}
+		}
+		if count >= limit.Max {
+			return database.Comment{}, database.CommentRateLimitError{Limit: limit}
+		}
+	}
+
+	comment := database.Comment{
+		ID:                  uuid.New(),
+		CreatedAt:           now(),
+		UpdatedAt:           now(),
+		CreateCommentParams: params,
+	}
+	s.comments[comment.ID] = comment
+	return comment, nil
+}
+
+func (s *Store) GetComment(ctx context.Context, id uuid.UUID) (database.Comment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	comment, ok := s.comments[id]
+	if !ok {
+		return database.Comment{}, database.ErrNotFound
+	}
+	return s.withReplyCount(comment), nil
+}
+
+func (s *Store) withReplyCount(comment database.Comment) database.Comment {
+	comment.ReplyCount = 0
+	for _, reply := range s.comments {
+		if reply.ParentID != nil && *reply.ParentID == comment.ID {
+			comment.ReplyCount++
+		}
+	}
+	return comment
+}
+
+func (s *Store) GetComments(ctx context.Context, params database.GetCommentsParams) (database.CommentPage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	comments := []database.Comment{}
+	for _, comment := range s.comments {
+		if comment.VideoID != params.VideoID {
+			continue
+		}
+		if params.ParentID == nil && comment.ParentID != nil {
+			continue
+		}
+		if params.ParentID != nil && (comment.ParentID == nil || *comment.ParentID != *params.ParentID) {
+			continue
+		}
+		comments = append(comments, s.withReplyCount(comment))
+	}
+	sort.Slice(comments, func(i, j int) bool {
+		a, b := comments[i], comments[j]
+		if params.ParentID != nil {
+			if !a.CreatedAt.Equal(b.CreatedAt) {
+				return a.CreatedAt.Before(b.CreatedAt)
+			}
+			return a.ID.String() < b.ID.String()
+		}
+		if a.Pinned != b.Pinned {
+			return a.Pinned
+		}
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		return a.ID.String() < b.ID.String()
+	})
+
+	page := database.CommentPage{Comments: []database.Comment{}, Total: len(comments)}
+	if params.Offset < len(comments) {
+		comments = comments[params.Offset:]
+		page.Comments = comments[:min(params.Limit, len(comments))]
+	}
+	return page, nil
+}
+
+func (s *Store) UpdateComment(ctx context.Context, id uuid.UUID, body string) (database.Comment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	comment, ok := s.comments[id]
+	if !ok {
+		return database.Comment{}, database.ErrNotFound
+	}
+	comment.Body = body
+	comment.UpdatedAt = now()
+	s.comments[id] = comment
+	return s.withReplyCount(comment), nil
+}
+
+func (s *Store) DeleteComment(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.comments[id]; !ok {
+		return database.ErrNotFound
+	}
+	for replyID, reply := range s.comments {
+		if reply.ParentID != nil && *reply.ParentID == id {
+			delete(s.comments, replyID)
+		}
+	}
+	delete(s.comments, id)
+	return nil
+}
+
+func (s *Store) PinComment(ctx context.Context, id uuid.UUID, pinned bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	comment, ok := s.comments[id]
+	if !ok || comment.ParentID != nil {
+		return database.ErrNotFound
+	}
+	if pinned {
+		for otherID, other := range s.comments {
+			if other.VideoID == comment.VideoID && other.Pinned {
+				other.Pinned = false
+				s.comments[otherID] = other
+			}
+		}
+	}
+	comment.Pinned = pinned
+	s.comments[id] = comment
+	return nil
+}
+
+func (s *Store) SetCommentsDisabled(ctx context.Context, videoID uuid.UUID, disabled bool) (database.Video, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	video, ok := s.videos[videoID]
+	if !ok || video.DeletedAt != nil {
+		return database.Video{}, database.ErrNotFound
+	}
+	video.CommentsDisabled = disabled
+	video.UpdatedAt = now()
+	video.Version++
+	s.videos[videoID] = video
+	return video, nil
+}
+
+// Reactions
+
+func (s *Store) GetVideoReaction(ctx context.Context, videoID, userID uuid.UUID) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.reactions[reactionKey{videoID, userID}], nil
+}
+
+func (s *Store) SetVideoReaction(ctx context.Context, videoID, userID uuid.UUID, reaction string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	video, ok := s.videos[videoID]
+	if !ok {
+		return database.ErrNotFound
+	}
+	key := reactionKey{videoID, userID}
+	existing := s.reactions[key]
+	if existing == reaction {
+		return nil
+	}
+	// Videos handed out earlier share the map, so count into a copy.
+	video.Reactions = maps.Clone(video.Reactions)
+	if existing != "" {
+		video.Reactions[existing]--
+	}
+	video.Reactions[reaction]++
+	s.reactions[key] = reaction
+	s.videos[videoID] = video
+	return nil
+}
+
+func (s *Store) DeleteVideoReaction(ctx context.Context, videoID, userID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := reactionKey{videoID, userID}
+	existing, ok := s.reactions[key]
+	if !ok {
+		return nil
+	}
+	delete(s.reactions, key)
+	if video, ok := s.videos[videoID]; ok {
+		video.Reactions = maps.Clone(video.Reactions)
+		video.Reactions[existing]--
+		s.videos[videoID] = video
+	}
+	return nil
+}
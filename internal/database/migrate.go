@@ -0,0 +1,332 @@
+package database
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+//go:embed migrations/sqlite/*.sql migrations/postgres/*.sql
+var migrationFiles embed.FS
+
+// ErrSchemaTooNew is returned when the database was migrated by a newer
+// build that knows about migrations this one doesn't.
+var ErrSchemaTooNew = errors.New("database schema is newer than this build supports")
+
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// sqliteTableRebuilds are the SQLite migrations that drop a table and
+// rename a new copy into its place. Dropping a table deletes its rows,
+// which foreign keys would cascade or refuse, so they run with foreign keys
+// off.
+var sqliteTableRebuilds = map[int]bool{
+	2: true,
+}
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Migration
+	Applied bool
+}
+
+// loadMigrations reads the embedded migration files for a dialect, ordered
+// by version. Both dialects share version numbers.
+func loadMigrations(d dialect) ([]Migration, error) {
+	dir := "migrations/" + string(d)
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		match := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %q", entry.Name())
+		}
+		version, err := strconv.Atoi(match[1])
+		if err != nil {
+			return nil, err
+		}
+		data, err := migrationFiles.ReadFile(dir + "/" + entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d is missing its up or down file", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration versions must be sequential, expected %d but found %d", i+1, m.Version)
+		}
+	}
+	return migrations, nil
+}
+
+func (c Client) ensureMigrationsTable() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	`
+	_, err := c.db.Exec(query)
+	return err
+}
+
+// SchemaVersion returns the version of the last applied migration, or 0 for
+// an empty database.
+func (c Client) SchemaVersion() (int, error) {
+	var version int
+	err := c.db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	return version, err
+}
+
+// LatestSchemaVersion is the version of the newest migration in this build.
+func (c Client) LatestSchemaVersion() (int, error) {
+	migrations, err := loadMigrations(c.db.dialect)
+	if err != nil {
+		return 0, err
+	}
+	return len(migrations), nil
+}
+
+// checkSchemaVersion refuses databases migrated past what this build knows.
+func (c Client) checkSchemaVersion() error {
+	current, err := c.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	latest, err := c.LatestSchemaVersion()
+	if err != nil {
+		return err
+	}
+	if current > latest {
+		return fmt.Errorf("%w: database is at version %d, this build knows up to %d", ErrSchemaTooNew, current, latest)
+	}
+	return nil
+}
+
+// MigrateStatus lists every known migration and whether it has been applied.
+func (c Client) MigrateStatus() ([]MigrationStatus, error) {
+	migrations, err := loadMigrations(c.db.dialect)
+	if err != nil {
+		return nil, err
+	}
+	current, err := c.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, len(migrations))
+	for i, m := range migrations {
+		statuses[i] = MigrationStatus{
+			Migration: m,
+			Applied:   m.Version <= current,
+		}
+	}
+	return statuses, nil
+}
+
+// MigrateUp applies every pending migration and returns how many ran.
+func (c Client) MigrateUp() (int, error) {
+	latest, err := c.LatestSchemaVersion()
+	if err != nil {
+		return 0, err
+	}
+	return c.MigrateTo(latest)
+}
+
+// MigrateDown rolls back the given number of applied migrations.
+func (c Client) MigrateDown(steps int) (int, error) {
+	current, err := c.SchemaVersion()
+	if err != nil {
+		return 0, err
+	}
+	return c.MigrateTo(max(current-steps, 0))
+}
+
+// MigrateTo applies or rolls back migrations, one transaction each, until
+// the schema is at the target version. It returns how many ran.
+func (c Client) MigrateTo(target int) (int, error) {
+	migrations, err := loadMigrations(c.db.dialect)
+	if err != nil {
+		return 0, err
+	}
+	if target < 0 || target > len(migrations) {
+		return 0, fmt.Errorf("unknown schema version %d", target)
+	}
+	current, err := c.SchemaVersion()
+	if err != nil {
+		return 0, err
+	}
+	if current > len(migrations) {
+		return 0, ErrSchemaTooNew
+	}
+
+	if current == 0 && c.db.dialect == dialectSQLite {
+		if err := c.adoptLegacySchema(); err != nil {
+			return 0, fmt.Errorf("adopt existing schema: %w", err)
+		}
+	}
+
+	ran := 0
+	for current < target {
+		m := migrations[current]
+		if err := c.applyMigration(m.Version, m.Up, "INSERT INTO schema_migrations (version, name) VALUES (?, ?)", m.Version, m.Name); err != nil {
+			return ran, fmt.Errorf("migration %d_%s up: %w", m.Version, m.Name, err)
+		}
+		current++
+		ran++
+	}
+	for current > target {
+		m := migrations[current-1]
+		if err := c.applyMigration(m.Version, m.Down, "DELETE FROM schema_migrations WHERE version = ?", m.Version); err != nil {
+			return ran, fmt.Errorf("migration %d_%s down: %w", m.Version, m.Name, err)
+		}
+		current--
+		ran++
+	}
+	return ran, nil
+}
+
+func (c Client) applyMigration(version int, script, record string, args ...interface{}) error {
+	if c.db.dialect == dialectSQLite && sqliteTableRebuilds[version] {
+		return c.applyMigrationWithoutForeignKeys(script, record, args...)
+	}
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(script); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// applyMigrationWithoutForeignKeys runs a SQLite migration with foreign
+// keys off. The setting can't change inside a transaction and only applies
+// to one connection, so a connection is set aside for the migration and has
+// foreign keys turned back on before it returns to the pool.
+func (c Client) applyMigrationWithoutForeignKeys(script, record string, args ...interface{}) error {
+	ctx := context.Background()
+	sqlConn, err := c.db.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer sqlConn.Close()
+
+	if _, err := sqlConn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+		return err
+	}
+	err = func() error {
+		t, err := sqlConn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		tx := &tx{Tx: t, dialect: c.db.dialect}
+		defer tx.Rollback()
+
+		if _, err := tx.Exec(script); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(record, args...); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}()
+	if _, pragmaErr := sqlConn.ExecContext(ctx, "PRAGMA foreign_keys = ON"); err == nil {
+		err = pragmaErr
+	}
+	return err
+}
+
+// legacyVideoColumns were added to the videos table while the schema was
+// still created by CREATE TABLE IF NOT EXISTS, so databases from that time
+// may be missing some of them.
+var legacyVideoColumns = []struct {
+	name       string
+	definition string
+}{
+	{"duration", "REAL"},
+	{"original_key", "TEXT"},
+	{"audio_url", "TEXT"},
+	{"audio_duration", "REAL"},
+}
+
+// adoptLegacySchema brings a database created before migrations existed up
+// to the shape of the first migration so the rest can apply on top of it.
+func (c Client) adoptLegacySchema() error {
+	rows, err := c.db.Query("SELECT name FROM pragma_table_info('videos')")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	existing := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		existing[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(existing) == 0 {
+		return nil
+	}
+
+	for _, column := range legacyVideoColumns {
+		if existing[column.name] {
+			continue
+		}
+		_, err := c.db.Exec(fmt.Sprintf("ALTER TABLE videos ADD COLUMN %s %s", column.name, column.definition))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+CREATE TABLE IF NOT EXISTS users (
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	password TEXT NOT NULL,
+	email TEXT UNIQUE NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+	token TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	revoked_at TIMESTAMPTZ,
+	user_id UUID NOT NULL REFERENCES users(id),
+	expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS videos (
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	title TEXT NOT NULL,
+	description TEXT,
+	thumbnail_url TEXT,
+	video_url TEXT,
+	duration DOUBLE PRECISION,
+	original_key TEXT,
+	audio_url TEXT,
+	audio_duration DOUBLE PRECISION,
+	user_id UUID REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS video_captions (
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	video_id UUID NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+	language TEXT NOT NULL,
+	label TEXT NOT NULL,
+	url TEXT NOT NULL,
+	UNIQUE(video_id, language)
+);
+
+CREATE TABLE IF NOT EXISTS video_chapters (
+	id UUID PRIMARY KEY,
+	video_id UUID NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+	title TEXT NOT NULL,
+	start_time DOUBLE PRECISION NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS video_fingerprints (
+	video_id UUID PRIMARY KEY REFERENCES videos(id) ON DELETE CASCADE,
+	user_id UUID NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	content_hash TEXT NOT NULL,
+	frame_hashes TEXT NOT NULL,
+	duration DOUBLE PRECISION NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_video_fingerprints_content_hash ON video_fingerprints(content_hash);
+CREATE INDEX IF NOT EXISTS idx_video_fingerprints_duration ON video_fingerprints(duration);
@@ -0,0 +1,3 @@
+-- The Postgres schema started out with the corrected column types, so only
+-- the index from the SQLite rebuild is needed here.
+CREATE INDEX idx_videos_user_id_created_at ON videos(user_id, created_at);
@@ -0,0 +1,8 @@
+ALTER TABLE videos ADD COLUMN aspect_ratio TEXT;
+ALTER TABLE videos ADD COLUMN processing_status TEXT NOT NULL DEFAULT 'pending';
+
+UPDATE videos SET processing_status = 'ready' WHERE video_url IS NOT NULL;
+
+CREATE INDEX idx_videos_user_id_updated_at ON videos(user_id, updated_at);
+CREATE INDEX idx_videos_user_id_title ON videos(user_id, title);
+CREATE INDEX idx_videos_user_id_processing_status ON videos(user_id, processing_status);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_videos_search_vector;
+ALTER TABLE videos DROP COLUMN search_vector;
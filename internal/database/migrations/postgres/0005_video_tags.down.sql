@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_video_tags_tag_id;
+DROP TABLE IF EXISTS video_tags;
+DROP TABLE IF EXISTS tags;
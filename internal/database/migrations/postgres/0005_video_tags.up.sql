@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS tags (
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	user_id UUID NOT NULL REFERENCES users(id),
+	name TEXT NOT NULL,
+	UNIQUE(user_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS video_tags (
+	video_id UUID NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+	tag_id UUID NOT NULL REFERENCES tags(id),
+	PRIMARY KEY(video_id, tag_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_video_tags_tag_id ON video_tags(tag_id);
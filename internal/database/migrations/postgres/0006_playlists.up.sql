@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS playlists (
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	title TEXT NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	visibility TEXT NOT NULL DEFAULT 'private',
+	thumbnail_url TEXT,
+	user_id UUID NOT NULL REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_playlists_user_id ON playlists(user_id);
+
+CREATE TABLE IF NOT EXISTS playlist_items (
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	playlist_id UUID NOT NULL REFERENCES playlists(id) ON DELETE CASCADE,
+	video_id UUID NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+	position INTEGER NOT NULL,
+	UNIQUE(playlist_id, video_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_playlist_items_playlist_id_position ON playlist_items(playlist_id, position);
+CREATE INDEX IF NOT EXISTS idx_playlist_items_video_id ON playlist_items(video_id);
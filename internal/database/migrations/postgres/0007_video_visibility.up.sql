@@ -0,0 +1,6 @@
+ALTER TABLE videos ADD COLUMN visibility TEXT NOT NULL DEFAULT 'private';
+
+-- Videos used to be readable by anyone with the ID, keep their links working
+UPDATE videos SET visibility = 'unlisted';
+
+CREATE INDEX IF NOT EXISTS idx_videos_visibility_created_at ON videos(visibility, created_at);
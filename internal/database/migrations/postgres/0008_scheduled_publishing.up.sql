@@ -0,0 +1,17 @@
+ALTER TABLE videos ADD COLUMN publish_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_videos_publish_at ON videos(publish_at);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	event TEXT NOT NULL,
+	url TEXT NOT NULL,
+	payload TEXT NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	next_attempt_at TIMESTAMPTZ,
+	delivered_at TIMESTAMPTZ,
+	last_error TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_next_attempt_at ON webhook_deliveries(next_attempt_at);
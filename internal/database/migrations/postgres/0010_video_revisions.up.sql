@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS video_revisions (
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	video_id UUID NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+	number INTEGER NOT NULL,
+	kind TEXT NOT NULL,
+	changes TEXT NOT NULL,
+	rollback_of UUID,
+	user_id UUID REFERENCES users(id),
+	UNIQUE(video_id, number)
+);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS video_daily_stats;
+DROP INDEX IF EXISTS idx_playback_sessions_video_id_day;
+DROP TABLE IF EXISTS playback_sessions;
@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS playback_sessions (
+	video_id UUID NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+	session_id TEXT NOT NULL,
+	day TEXT NOT NULL,
+	started_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	last_event_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	last_position DOUBLE PRECISION NOT NULL DEFAULT 0,
+	max_position DOUBLE PRECISION NOT NULL DEFAULT 0,
+	watch_time DOUBLE PRECISION NOT NULL DEFAULT 0,
+	completed BOOLEAN NOT NULL DEFAULT FALSE,
+	PRIMARY KEY(video_id, session_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_playback_sessions_video_id_day ON playback_sessions(video_id, day);
+
+CREATE TABLE IF NOT EXISTS video_daily_stats (
+	video_id UUID NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+	day TEXT NOT NULL,
+	views INTEGER NOT NULL DEFAULT 0,
+	watch_time DOUBLE PRECISION NOT NULL DEFAULT 0,
+	completions INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY(video_id, day)
+);
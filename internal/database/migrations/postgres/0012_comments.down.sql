@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_comments_user_id_created_at;
+DROP INDEX IF EXISTS idx_comments_parent_id;
+DROP INDEX IF EXISTS idx_comments_video_id_parent_id;
+DROP TABLE IF EXISTS comments;
+
+ALTER TABLE videos DROP COLUMN comments_disabled;
@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS sessions (
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	last_used_at TIMESTAMPTZ NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL,
+	revoked_at TIMESTAMPTZ,
+	user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	user_agent TEXT NOT NULL DEFAULT '',
+	ip TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
+
+-- Each existing refresh token family becomes a session with no client
+-- details.
+INSERT INTO sessions (id, created_at, last_used_at, expires_at, revoked_at, user_id)
+SELECT
+	family_id,
+	MIN(created_at),
+	MAX(updated_at),
+	MAX(expires_at),
+	CASE WHEN COUNT(*) = COUNT(revoked_at) THEN MAX(revoked_at) END,
+	MIN(user_id::text)::uuid
+FROM refresh_tokens
+GROUP BY family_id;
@@ -0,0 +1,2 @@
+-- version counts writes to a video and backs its ETag.
+ALTER TABLE videos ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,2 @@
+-- Postgres keeps searching the tsvector column from 0004. Only the SQLite
+-- index changes in this version.
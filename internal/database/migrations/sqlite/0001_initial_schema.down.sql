@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS video_fingerprints;
+DROP TABLE IF EXISTS video_chapters;
+DROP TABLE IF EXISTS video_captions;
+DROP TABLE IF EXISTS videos;
+DROP TABLE IF EXISTS refresh_tokens;
+DROP TABLE IF EXISTS users;
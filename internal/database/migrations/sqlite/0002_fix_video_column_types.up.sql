@@ -0,0 +1,32 @@
+-- videos.user_id was declared INTEGER while UUID strings are stored in it,
+-- and video_url was declared "TEXT TEXT". SQLite can't alter column types,
+-- so the table is rebuilt.
+CREATE TABLE videos_new (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	title TEXT NOT NULL,
+	description TEXT,
+	thumbnail_url TEXT,
+	video_url TEXT,
+	duration REAL,
+	original_key TEXT,
+	audio_url TEXT,
+	audio_duration REAL,
+	user_id TEXT,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+INSERT INTO videos_new (
+	id, created_at, updated_at, title, description, thumbnail_url,
+	video_url, duration, original_key, audio_url, audio_duration, user_id
+)
+SELECT
+	id, created_at, updated_at, title, description, thumbnail_url,
+	video_url, duration, original_key, audio_url, audio_duration, CAST(user_id AS TEXT)
+FROM videos;
+
+DROP TABLE videos;
+ALTER TABLE videos_new RENAME TO videos;
+
+CREATE INDEX idx_videos_user_id_created_at ON videos(user_id, created_at);
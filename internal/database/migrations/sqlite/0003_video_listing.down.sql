@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_videos_user_id_processing_status;
+DROP INDEX IF EXISTS idx_videos_user_id_title;
+DROP INDEX IF EXISTS idx_videos_user_id_updated_at;
+
+ALTER TABLE videos DROP COLUMN processing_status;
+ALTER TABLE videos DROP COLUMN aspect_ratio;
@@ -0,0 +1,29 @@
+-- FTS4 ships with the default go-sqlite3 build, FTS5 needs the sqlite_fts5
+-- build tag. The index keeps its own copy of the text rather than pointing at
+-- videos by rowid, since VACUUM may renumber rowids of a table without an
+-- INTEGER PRIMARY KEY.
+CREATE VIRTUAL TABLE videos_fts USING fts4(
+	video_id,
+	title,
+	description,
+	notindexed=video_id,
+	prefix="2,3",
+	tokenize=unicode61
+);
+
+INSERT INTO videos_fts (video_id, title, description)
+SELECT id, title, description FROM videos;
+
+CREATE TRIGGER videos_fts_insert AFTER INSERT ON videos BEGIN
+	INSERT INTO videos_fts (video_id, title, description)
+	VALUES (new.id, new.title, new.description);
+END;
+
+CREATE TRIGGER videos_fts_update AFTER UPDATE OF title, description ON videos BEGIN
+	UPDATE videos_fts SET title = new.title, description = new.description
+	WHERE video_id = old.id;
+END;
+
+CREATE TRIGGER videos_fts_delete AFTER DELETE ON videos BEGIN
+	DELETE FROM videos_fts WHERE video_id = old.id;
+END;
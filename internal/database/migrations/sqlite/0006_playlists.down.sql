@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_playlist_items_video_id;
+DROP INDEX IF EXISTS idx_playlist_items_playlist_id_position;
+DROP TABLE IF EXISTS playlist_items;
+DROP INDEX IF EXISTS idx_playlists_user_id;
+DROP TABLE IF EXISTS playlists;
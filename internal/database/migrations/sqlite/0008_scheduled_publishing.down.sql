@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_webhook_deliveries_next_attempt_at;
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP INDEX IF EXISTS idx_videos_publish_at;
+
+ALTER TABLE videos DROP COLUMN publish_at;
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS video_revisions (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	video_id TEXT NOT NULL,
+	number INTEGER NOT NULL,
+	kind TEXT NOT NULL,
+	changes TEXT NOT NULL,
+	rollback_of TEXT,
+	user_id TEXT,
+	UNIQUE(video_id, number),
+	FOREIGN KEY(video_id) REFERENCES videos(id) ON DELETE CASCADE,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
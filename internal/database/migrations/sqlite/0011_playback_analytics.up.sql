@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS playback_sessions (
+	video_id TEXT NOT NULL,
+	session_id TEXT NOT NULL,
+	day TEXT NOT NULL,
+	started_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	last_event_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	last_position REAL NOT NULL DEFAULT 0,
+	max_position REAL NOT NULL DEFAULT 0,
+	watch_time REAL NOT NULL DEFAULT 0,
+	completed BOOLEAN NOT NULL DEFAULT FALSE,
+	PRIMARY KEY(video_id, session_id),
+	FOREIGN KEY(video_id) REFERENCES videos(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_playback_sessions_video_id_day ON playback_sessions(video_id, day);
+
+CREATE TABLE IF NOT EXISTS video_daily_stats (
+	video_id TEXT NOT NULL,
+	day TEXT NOT NULL,
+	views INTEGER NOT NULL DEFAULT 0,
+	watch_time REAL NOT NULL DEFAULT 0,
+	completions INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY(video_id, day),
+	FOREIGN KEY(video_id) REFERENCES videos(id) ON DELETE CASCADE
+);
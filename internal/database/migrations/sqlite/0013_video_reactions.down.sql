@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS video_reactions;
+
+ALTER TABLE videos DROP COLUMN like_count;
+ALTER TABLE videos DROP COLUMN dislike_count;
+ALTER TABLE videos DROP COLUMN love_count;
+ALTER TABLE videos DROP COLUMN laugh_count;
+ALTER TABLE videos DROP COLUMN wow_count;
+ALTER TABLE videos DROP COLUMN sad_count;
+ALTER TABLE videos DROP COLUMN angry_count;
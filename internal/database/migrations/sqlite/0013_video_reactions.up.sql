@@ -0,0 +1,17 @@
+ALTER TABLE videos ADD COLUMN like_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE videos ADD COLUMN dislike_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE videos ADD COLUMN love_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE videos ADD COLUMN laugh_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE videos ADD COLUMN wow_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE videos ADD COLUMN sad_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE videos ADD COLUMN angry_count INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS video_reactions (
+	video_id TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	reaction TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY(video_id, user_id),
+	FOREIGN KEY(video_id) REFERENCES videos(id) ON DELETE CASCADE,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
@@ -0,0 +1,16 @@
+ALTER TABLE refresh_tokens ADD COLUMN family_id TEXT;
+ALTER TABLE refresh_tokens ADD COLUMN replaced_by TEXT;
+
+-- Tokens issued before rotation each start a family of their own. SQLite
+-- has no UUID function, so a random (version 4) one is put together in the
+-- hyphenated form uuid.UUID is written in.
+UPDATE refresh_tokens
+SET family_id = lower(
+	hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' ||
+	substr(hex(randomblob(2)), 2) || '-' ||
+	substr('89AB', 1 + abs(random() % 4), 1) || substr(hex(randomblob(2)), 2) || '-' ||
+	hex(randomblob(6))
+)
+WHERE family_id IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family_id ON refresh_tokens(family_id);
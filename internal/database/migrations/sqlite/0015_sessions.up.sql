@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS sessions (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	last_used_at TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	revoked_at TIMESTAMP,
+	user_id TEXT NOT NULL,
+	user_agent TEXT NOT NULL DEFAULT '',
+	ip TEXT NOT NULL DEFAULT '',
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
+
+-- Each existing refresh token family becomes a session with no client
+-- details.
+INSERT INTO sessions (id, created_at, last_used_at, expires_at, revoked_at, user_id)
+SELECT
+	family_id,
+	MIN(created_at),
+	MAX(updated_at),
+	MAX(expires_at),
+	CASE WHEN COUNT(*) = COUNT(revoked_at) THEN MAX(revoked_at) END,
+	MIN(user_id)
+FROM refresh_tokens
+GROUP BY family_id;
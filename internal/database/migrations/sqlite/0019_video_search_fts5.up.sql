@@ -0,0 +1,32 @@
+-- Rebuilds the search index with FTS5, which ranks with bm25() and
+-- highlights matches in SQL. go-sqlite3 only compiles FTS5 in when built
+-- with the sqlite_fts5 tag.
+DROP TRIGGER IF EXISTS videos_fts_delete;
+DROP TRIGGER IF EXISTS videos_fts_update;
+DROP TRIGGER IF EXISTS videos_fts_insert;
+DROP TABLE IF EXISTS videos_fts;
+
+CREATE VIRTUAL TABLE videos_fts USING fts5(
+	video_id UNINDEXED,
+	title,
+	description,
+	prefix='2 3',
+	tokenize='unicode61'
+);
+
+INSERT INTO videos_fts (video_id, title, description)
+SELECT id, title, description FROM videos;
+
+CREATE TRIGGER videos_fts_insert AFTER INSERT ON videos BEGIN
+	INSERT INTO videos_fts (video_id, title, description)
+	VALUES (new.id, new.title, new.description);
+END;
+
+CREATE TRIGGER videos_fts_update AFTER UPDATE OF title, description ON videos BEGIN
+	UPDATE videos_fts SET title = new.title, description = new.description
+	WHERE video_id = old.id;
+END;
+
+CREATE TRIGGER videos_fts_delete AFTER DELETE ON videos BEGIN
+	DELETE FROM videos_fts WHERE video_id = old.id;
+END;
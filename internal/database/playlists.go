@@ -0,0 +1,549 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	VisibilityPrivate  = "private"
+	VisibilityUnlisted = "unlisted"
+	VisibilityPublic   = "public"
+)
+
+// ErrInvalidPlaylistOrder is returned when a reorder doesn't list every item
+// of the playlist exactly once.
+var ErrInvalidPlaylistOrder = errors.New("order must list every playlist item once")
+
+type Playlist struct {
+	ID           uuid.UUID `json:"id"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	ThumbnailURL *string   `json:"thumbnail_url"`
+	CreatePlaylistParams
+}
+
+type CreatePlaylistParams struct {
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Visibility  string    `json:"visibility"`
+	UserID      uuid.UUID `json:"user_id"`
+}
+
+// PlaylistItem is a video's place in a playlist. Positions start at 0 and
+// have no gaps.
+type PlaylistItem struct {
+	ID         uuid.UUID `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	PlaylistID uuid.UUID `json:"playlist_id"`
+	Position   int       `json:"position"`
+	Video      Video     `json:"video"`
+}
+
+const playlistColumns = `
+		id,
+		created_at,
+		updated_at,
+		title,
+		description,
+		visibility,
+		thumbnail_url,
+		user_id`
+
+func scanPlaylist(row interface{ Scan(...interface{}) error }) (Playlist, error) {
+	var playlist Playlist
+	err := row.Scan(
+		&playlist.ID,
+		&playlist.CreatedAt,
+		&playlist.UpdatedAt,
+		&playlist.Title,
+		&playlist.Description,
+		&playlist.Visibility,
+		&playlist.ThumbnailURL,
+		&playlist.UserID,
+	)
+	return playlist, err
+}
+
+func (c Client) CreatePlaylist(ctx context.Context, params CreatePlaylistParams) (Playlist, error) {
+	id := uuid.New()
+	query := `
+	INSERT INTO playlists (
+		id,
+		created_at,
+		updated_at,
+		title,
+		description,
+		visibility,
+		user_id
+	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?)
+	`
+	_, err := c.db.ExecContext(ctx, query, id, params.Title, params.Description, params.Visibility, params.UserID)
+	if err != nil {
+		return Playlist{}, err
+	}
+
+	return c.GetPlaylist(ctx, id)
+}
+
+func (c Client) GetPlaylist(ctx context.Context, id uuid.UUID) (Playlist, error) {
+	query := `
+	SELECT` + playlistColumns + `
+	FROM playlists
+	WHERE id = ?
+	`
+	playlist, err := scanPlaylist(c.db.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Playlist{}, ErrNotFound
+	}
+	if err != nil {
+		return Playlist{}, err
+	}
+	return playlist, nil
+}
+
+func (c Client) GetPlaylists(ctx context.Context, userID uuid.UUID) ([]Playlist, error) {
+	query := `
+	SELECT` + playlistColumns + `
+	FROM playlists
+	WHERE user_id = ?
+	ORDER BY created_at DESC
+	`
+	rows, err := c.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	playlists := []Playlist{}
+	for rows.Next() {
+		playlist, err := scanPlaylist(rows)
+		if err != nil {
+			return nil, err
+		}
+		playlists = append(playlists, playlist)
+	}
+	return playlists, rows.Err()
+}
+
+func (c Client) UpdatePlaylist(ctx context.Context, playlist Playlist) error {
+	query := `
+	UPDATE playlists
+	SET
+		updated_at = CURRENT_TIMESTAMP,
+		title = ?,
+		description = ?,
+		visibility = ?,
+		thumbnail_url = ?
+	WHERE id = ?
+	`
+	return requireRowsAffected(c.db.ExecContext(ctx,
+		query,
+		playlist.Title,
+		playlist.Description,
+		playlist.Visibility,
+		playlist.ThumbnailURL,
+		playlist.ID,
+	))
+}
+
+func (c Client) DeletePlaylist(ctx context.Context, id uuid.UUID) error {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM playlist_items WHERE playlist_id = ?", id)
+	if err != nil {
+		return err
+	}
+	err = requireRowsAffected(tx.ExecContext(ctx, "DELETE FROM playlists WHERE id = ?", id))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetPlaylistItems returns a playlist's items in order with their videos.
+// Items of trashed videos are left out but keep their positions, so they
+// come back in place if the video is restored.
+func (c Client) GetPlaylistItems(ctx context.Context, playlistID uuid.UUID) ([]PlaylistItem, error) {
+	query := `
+	SELECT playlist_items.id, playlist_items.created_at, playlist_items.playlist_id, playlist_items.video_id, playlist_items.position
+	FROM playlist_items
+	JOIN videos ON videos.id = playlist_items.video_id
+	WHERE playlist_items.playlist_id = ? AND videos.deleted_at IS NULL
+	ORDER BY playlist_items.position
+	`
+	rows, err := c.db.QueryContext(ctx, query, playlistID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []PlaylistItem{}
+	for rows.Next() {
+		var item PlaylistItem
+		if err := rows.Scan(&item.ID, &item.CreatedAt, &item.PlaylistID, &item.Video.ID, &item.Position); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	videoQuery := `
+	SELECT` + videoColumns + `
+	FROM videos
+	WHERE id IN (SELECT video_id FROM playlist_items WHERE playlist_id = ?) AND deleted_at IS NULL
+	`
+	videos, err := c.queryVideos(ctx, videoQuery, playlistID)
+	if err != nil {
+		return nil, err
+	}
+	err = c.loadVideoTags(ctx, videos)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := map[uuid.UUID]Video{}
+	for _, video := range videos {
+		byID[video.ID] = video
+	}
+	for i := range items {
+		items[i].Video = byID[items[i].Video.ID]
+	}
+	return items, nil
+}
+
+// AddPlaylistItem inserts a video into a playlist at position, shifting later
+// items down, or appends it when position is nil or past the end. Adding a
+// video that is already in the playlist returns ErrConflict.
+func (c Client) AddPlaylistItem(ctx context.Context, playlistID, videoID uuid.UUID, position *int) (PlaylistItem, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return PlaylistItem{}, err
+	}
+	defer tx.Rollback()
+
+	order, err := playlistOrder(ctx, tx, playlistID)
+	if err != nil {
+		return PlaylistItem{}, err
+	}
+
+	id := uuid.New()
+	query := `
+	INSERT INTO playlist_items (
+		id,
+		created_at,
+		playlist_id,
+		video_id,
+		position
+	) VALUES (?, CURRENT_TIMESTAMP, ?, ?, ?)
+	`
+	_, err = tx.ExecContext(ctx, query, id, playlistID, videoID, len(order))
+	if isUniqueViolation(err) {
+		return PlaylistItem{}, ErrConflict
+	}
+	if err != nil {
+		return PlaylistItem{}, err
+	}
+
+	if position != nil && *position < len(order) {
+		order = MovePlaylistPosition(append(order, id), len(order), *position)
+		err = writePlaylistOrder(ctx, tx, playlistID, order)
+		if err != nil {
+			return PlaylistItem{}, err
+		}
+	}
+	err = touchPlaylist(ctx, tx, playlistID)
+	if err != nil {
+		return PlaylistItem{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return PlaylistItem{}, err
+	}
+	return c.getPlaylistItem(ctx, playlistID, id)
+}
+
+// MovePlaylistItem moves an item to position, clamped to the playlist.
+func (c Client) MovePlaylistItem(ctx context.Context, playlistID, itemID uuid.UUID, position int) error {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	order, err := playlistOrder(ctx, tx, playlistID)
+	if err != nil {
+		return err
+	}
+	from := indexOf(order, itemID)
+	if from == -1 {
+		return ErrNotFound
+	}
+
+	err = writePlaylistOrder(ctx, tx, playlistID, MovePlaylistPosition(order, from, position))
+	if err != nil {
+		return err
+	}
+	err = touchPlaylist(ctx, tx, playlistID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ReorderPlaylistItems puts the items of a playlist in the given order.
+// itemIDs lists the items GetPlaylistItems returns; items of trashed videos
+// stay where they are.
+func (c Client) ReorderPlaylistItems(ctx context.Context, playlistID uuid.UUID, itemIDs []uuid.UUID) error {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	order, err := playlistOrder(ctx, tx, playlistID)
+	if err != nil {
+		return err
+	}
+	trashed, err := trashedPlaylistItems(ctx, tx, playlistID)
+	if err != nil {
+		return err
+	}
+	visible := slices.DeleteFunc(slices.Clone(order), func(id uuid.UUID) bool {
+		return trashed[id]
+	})
+	if !SamePlaylistItems(visible, itemIDs) {
+		return ErrInvalidPlaylistOrder
+	}
+
+	err = writePlaylistOrder(ctx, tx, playlistID, MergePlaylistOrder(order, trashed, itemIDs))
+	if err != nil {
+		return err
+	}
+	err = touchPlaylist(ctx, tx, playlistID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (c Client) RemovePlaylistItem(ctx context.Context, playlistID, itemID uuid.UUID) error {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = requireRowsAffected(tx.ExecContext(ctx, "DELETE FROM playlist_items WHERE id = ? AND playlist_id = ?", itemID, playlistID))
+	if err != nil {
+		return err
+	}
+
+	order, err := playlistOrder(ctx, tx, playlistID)
+	if err != nil {
+		return err
+	}
+	err = writePlaylistOrder(ctx, tx, playlistID, order)
+	if err != nil {
+		return err
+	}
+	err = touchPlaylist(ctx, tx, playlistID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (c Client) getPlaylistItem(ctx context.Context, playlistID, itemID uuid.UUID) (PlaylistItem, error) {
+	items, err := c.GetPlaylistItems(ctx, playlistID)
+	if err != nil {
+		return PlaylistItem{}, err
+	}
+	for _, item := range items {
+		if item.ID == itemID {
+			return item, nil
+		}
+	}
+	return PlaylistItem{}, ErrNotFound
+}
+
+// removeVideoFromPlaylists deletes a video's playlist items and closes the
+// gaps it leaves in each playlist.
+func removeVideoFromPlaylists(ctx context.Context, tx *tx, videoID uuid.UUID) error {
+	rows, err := tx.QueryContext(ctx, "SELECT playlist_id FROM playlist_items WHERE video_id = ?", videoID)
+	if err != nil {
+		return err
+	}
+	playlistIDs := []uuid.UUID{}
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		playlistIDs = append(playlistIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM playlist_items WHERE video_id = ?", videoID)
+	if err != nil {
+		return err
+	}
+	for _, playlistID := range playlistIDs {
+		order, err := playlistOrder(ctx, tx, playlistID)
+		if err != nil {
+			return err
+		}
+		err = writePlaylistOrder(ctx, tx, playlistID, order)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// playlistOrder returns the item IDs of a playlist by position, or
+// ErrNotFound if the playlist doesn't exist.
+func playlistOrder(ctx context.Context, tx *tx, playlistID uuid.UUID) ([]uuid.UUID, error) {
+	var exists int
+	err := tx.QueryRowContext(ctx, "SELECT 1 FROM playlists WHERE id = ?", playlistID).Scan(&exists)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.QueryContext(ctx, "SELECT id FROM playlist_items WHERE playlist_id = ? ORDER BY position", playlistID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	order := []uuid.UUID{}
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		order = append(order, id)
+	}
+	return order, rows.Err()
+}
+
+// trashedPlaylistItems returns the IDs of a playlist's items whose videos
+// are in the trash.
+func trashedPlaylistItems(ctx context.Context, tx *tx, playlistID uuid.UUID) (map[uuid.UUID]bool, error) {
+	query := `
+	SELECT playlist_items.id
+	FROM playlist_items
+	JOIN videos ON videos.id = playlist_items.video_id
+	WHERE playlist_items.playlist_id = ? AND videos.deleted_at IS NOT NULL
+	`
+	rows, err := tx.QueryContext(ctx, query, playlistID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	trashed := map[uuid.UUID]bool{}
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		trashed[id] = true
+	}
+	return trashed, rows.Err()
+}
+
+func writePlaylistOrder(ctx context.Context, tx *tx, playlistID uuid.UUID, order []uuid.UUID) error {
+	for position, id := range order {
+		_, err := tx.ExecContext(ctx, "UPDATE playlist_items SET position = ? WHERE id = ? AND playlist_id = ?", position, id, playlistID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func touchPlaylist(ctx context.Context, tx *tx, playlistID uuid.UUID) error {
+	_, err := tx.ExecContext(ctx, "UPDATE playlists SET updated_at = CURRENT_TIMESTAMP WHERE id = ?", playlistID)
+	return err
+}
+
+// MovePlaylistPosition returns a copy of order with the entry at from moved
+// to position to, clamped to the ends of the list. Like SamePlaylistItems it
+// is exported for other Store implementations.
+func MovePlaylistPosition(order []uuid.UUID, from, to int) []uuid.UUID {
+	if to < 0 {
+		to = 0
+	}
+	if to >= len(order) {
+		to = len(order) - 1
+	}
+	id := order[from]
+	moved := make([]uuid.UUID, 0, len(order))
+	moved = append(moved, order[:from]...)
+	moved = append(moved, order[from+1:]...)
+	moved = append(moved[:to], append([]uuid.UUID{id}, moved[to:]...)...)
+	return moved
+}
+
+// MergePlaylistOrder returns order with the entries not in hidden replaced,
+// in turn, by itemIDs. Hidden entries keep their positions. Like
+// SamePlaylistItems it is exported for other Store implementations.
+func MergePlaylistOrder(order []uuid.UUID, hidden map[uuid.UUID]bool, itemIDs []uuid.UUID) []uuid.UUID {
+	merged := make([]uuid.UUID, 0, len(order))
+	next := 0
+	for _, id := range order {
+		if hidden[id] {
+			merged = append(merged, id)
+			continue
+		}
+		merged = append(merged, itemIDs[next])
+		next++
+	}
+	return merged
+}
+
+// SamePlaylistItems reports whether itemIDs lists every entry of order once.
+func SamePlaylistItems(order, itemIDs []uuid.UUID) bool {
+	if len(order) != len(itemIDs) {
+		return false
+	}
+	seen := map[uuid.UUID]bool{}
+	for _, id := range order {
+		seen[id] = true
+	}
+	for _, id := range itemIDs {
+		if !seen[id] {
+			return false
+		}
+		delete(seen, id)
+	}
+	return true
+}
+
+func indexOf(order []uuid.UUID, id uuid.UUID) int {
+	for i, other := range order {
+		if other == id {
+			return i
+		}
+	}
+	return -1
+}
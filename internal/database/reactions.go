@@ -0,0 +1,136 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ReactionLike    = "like"
+	ReactionDislike = "dislike"
+	ReactionLove    = "love"
+	ReactionLaugh   = "laugh"
+	ReactionWow     = "wow"
+	ReactionSad     = "sad"
+	ReactionAngry   = "angry"
+)
+
+// Reactions is the fixed set users can react to a video with, in the order
+// of their counter columns in videoColumns.
+var Reactions = []string{
+	ReactionLike,
+	ReactionDislike,
+	ReactionLove,
+	ReactionLaugh,
+	ReactionWow,
+	ReactionSad,
+	ReactionAngry,
+}
+
+func IsReaction(reaction string) bool {
+	return slices.Contains(Reactions, reaction)
+}
+
+// reactionColumn names the counter of a reaction. Callers must check
+// IsReaction first, since the name ends up in SQL.
+func reactionColumn(reaction string) string {
+	return reaction + "_count"
+}
+
+// GetVideoReaction returns the user's reaction to a video, or "" if they
+// haven't reacted.
+func (c Client) GetVideoReaction(ctx context.Context, videoID, userID uuid.UUID) (string, error) {
+	var reaction string
+	err := c.db.QueryRowContext(ctx, "SELECT reaction FROM video_reactions WHERE video_id = ? AND user_id = ?", videoID, userID).Scan(&reaction)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return reaction, err
+}
+
+// SetVideoReaction sets a user's one reaction to a video, replacing any
+// other. Setting the reaction they already have changes nothing.
+func (c Client) SetVideoReaction(ctx context.Context, videoID, userID uuid.UUID, reaction string) error {
+	if !IsReaction(reaction) {
+		return errors.New("unknown reaction " + reaction)
+	}
+
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var existing string
+	err = tx.QueryRowContext(ctx, "SELECT reaction FROM video_reactions WHERE video_id = ? AND user_id = ?", videoID, userID).Scan(&existing)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if existing == reaction {
+		return nil
+	}
+
+	if existing == "" {
+		query := `
+		INSERT INTO video_reactions (video_id, user_id, reaction, created_at)
+		VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+		`
+		_, err = tx.ExecContext(ctx, query, videoID, userID, reaction)
+	} else {
+		query := `
+		UPDATE video_reactions
+		SET reaction = ?, created_at = CURRENT_TIMESTAMP
+		WHERE video_id = ? AND user_id = ?
+		`
+		_, err = tx.ExecContext(ctx, query, reaction, videoID, userID)
+	}
+	if err != nil {
+		return err
+	}
+
+	query := "UPDATE videos SET " + reactionColumn(reaction) + " = " + reactionColumn(reaction) + " + 1"
+	if existing != "" && IsReaction(existing) {
+		query += ", " + reactionColumn(existing) + " = " + reactionColumn(existing) + " - 1"
+	}
+	err = requireRowsAffected(tx.ExecContext(ctx, query+" WHERE id = ?", videoID))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteVideoReaction removes a user's reaction to a video, if they have
+// one.
+func (c Client) DeleteVideoReaction(ctx context.Context, videoID, userID uuid.UUID) error {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var existing string
+	err = tx.QueryRowContext(ctx, "SELECT reaction FROM video_reactions WHERE video_id = ? AND user_id = ?", videoID, userID).Scan(&existing)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM video_reactions WHERE video_id = ? AND user_id = ?", videoID, userID)
+	if err != nil {
+		return err
+	}
+	if IsReaction(existing) {
+		query := "UPDATE videos SET " + reactionColumn(existing) + " = " + reactionColumn(existing) + " - 1 WHERE id = ?"
+		_, err = tx.ExecContext(ctx, query, videoID)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
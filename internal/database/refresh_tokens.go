@@ -1,66 +1,209 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+var (
+	// ErrTokenExpired is returned for a refresh token past its expires_at.
+	ErrTokenExpired = errors.New("refresh token expired")
+	// ErrTokenRevoked is returned for a refresh token that was revoked.
+	ErrTokenRevoked = errors.New("refresh token revoked")
+	// ErrTokenReused is returned when a refresh token that was already
+	// rotated is presented again. Its whole family is revoked, since either
+	// the client or an attacker holds a stolen copy.
+	ErrTokenReused = errors.New("refresh token reused")
+)
+
 type RefreshToken struct {
 	CreateRefreshTokenParams
 	CreatedAt time.Time  `json:"created_at"`
 	UpdatedAt time.Time  `json:"updated_at"`
 	RevokedAt *time.Time `json:"revoked_at"`
+	// ReplacedBy is the ID of the token this one was rotated to, if any.
+	ReplacedBy *uuid.UUID `json:"replaced_by"`
 }
 
 type CreateRefreshTokenParams struct {
-	Token     string    `json:"token"`
+	// ID is the lookup key clients send along with the secret.
+	ID uuid.UUID `json:"id"`
+	// TokenHash is the SHA-256 of the secret. The secret itself is never
+	// stored.
+	TokenHash string    `json:"-"`
 	UserID    uuid.UUID `json:"user_id"`
 	ExpiresAt time.Time `json:"expires_at"`
+	// FamilyID groups the tokens rotated from one login and is the ID of
+	// their Session. Leave it unset to start a new session.
+	FamilyID uuid.UUID `json:"family_id"`
+	// UserAgent and IP describe the client, and are recorded on the
+	// session.
+	UserAgent string `json:"-"`
+	IP        string `json:"-"`
+}
+
+// CheckRefreshToken reports why a refresh token can't be used at now, or
+// nil if it can.
+func CheckRefreshToken(rt RefreshToken, now time.Time) error {
+	switch {
+	case rt.ReplacedBy != nil:
+		return ErrTokenReused
+	case rt.RevokedAt != nil:
+		return ErrTokenRevoked
+	case !now.Before(rt.ExpiresAt):
+		return ErrTokenExpired
+	}
+	return nil
 }
 
-func (c Client) CreateRefreshToken(params CreateRefreshTokenParams) (RefreshToken, error) {
+func (c Client) CreateRefreshToken(ctx context.Context, params CreateRefreshTokenParams) (RefreshToken, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	defer tx.Rollback()
+
+	if params.FamilyID == uuid.Nil {
+		params.FamilyID = uuid.New()
+		err = c.createSession(ctx, tx, params)
+		if err != nil {
+			return RefreshToken{}, err
+		}
+	}
+	err = createRefreshToken(ctx, tx, params)
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return RefreshToken{}, err
+	}
+
+	return c.GetRefreshToken(ctx, params.ID)
+}
+
+func createRefreshToken(ctx context.Context, db execer, params CreateRefreshTokenParams) error {
 	query := `
 		INSERT INTO refresh_tokens (
-			token,
+			id,
+			token_hash,
 			created_at,
 			updated_at,
 			user_id,
-			expires_at
-		) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?)
+			expires_at,
+			family_id
+		) VALUES (?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?)
 	`
-	_, err := c.db.Exec(query, params.Token, params.UserID.String(), params.ExpiresAt)
+	_, err := db.ExecContext(ctx, query, params.ID, params.TokenHash, params.UserID.String(), params.ExpiresAt, params.FamilyID)
+	return err
+}
+
+// RotateRefreshToken exchanges a usable refresh token for a new one in the
+// same family and marks the session as used. params.FamilyID and
+// params.UserID are taken from the old token. Presenting a token that was
+// already rotated revokes its session and returns ErrTokenReused. The
+// caller must have checked the secret against the old token's hash.
+func (c Client) RotateRefreshToken(ctx context.Context, id uuid.UUID, params CreateRefreshTokenParams) (RefreshToken, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
 	if err != nil {
 		return RefreshToken{}, err
 	}
+	defer tx.Rollback()
 
-	return c.GetRefreshToken(params.Token)
-}
+	old, err := getRefreshToken(ctx, tx, id)
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	err = CheckRefreshToken(old, time.Now())
+	if errors.Is(err, ErrTokenReused) {
+		return RefreshToken{}, revokeReusedSession(ctx, tx, old.FamilyID)
+	}
+	if err != nil {
+		return RefreshToken{}, err
+	}
 
-func (c Client) RevokeRefreshToken(token string) error {
 	query := `
 		UPDATE refresh_tokens
-		SET revoked_at = CURRENT_TIMESTAMP
-		WHERE token = ?
+		SET revoked_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP, replaced_by = ?
+		WHERE id = ? AND revoked_at IS NULL
 	`
-	_, err := c.db.Exec(query, token)
-	return err
+	err = requireRowsAffected(tx.ExecContext(ctx, query, params.ID, id))
+	if errors.Is(err, ErrNotFound) {
+		// Another request rotated it first.
+		return RefreshToken{}, revokeReusedSession(ctx, tx, old.FamilyID)
+	}
+	if err != nil {
+		return RefreshToken{}, err
+	}
+
+	params.UserID = old.UserID
+	params.FamilyID = old.FamilyID
+	err = createRefreshToken(ctx, tx, params)
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	err = c.touchSession(ctx, tx, params)
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return RefreshToken{}, err
+	}
+	return c.GetRefreshToken(ctx, params.ID)
+}
+
+// revokeReusedSession revokes the session of a reused token, commits, and
+// returns ErrTokenReused.
+func revokeReusedSession(ctx context.Context, tx *tx, sessionID uuid.UUID) error {
+	err := revokeSession(ctx, tx, sessionID)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return ErrTokenReused
 }
 
-func (c Client) GetRefreshToken(token string) (RefreshToken, error) {
+// RevokeRefreshToken logs out the session the token belongs to.
+func (c Client) RevokeRefreshToken(ctx context.Context, id uuid.UUID) error {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rt, err := getRefreshToken(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	err = revokeSession(ctx, tx, rt.FamilyID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (c Client) GetRefreshToken(ctx context.Context, id uuid.UUID) (RefreshToken, error) {
+	return getRefreshToken(ctx, c.db, id)
+}
+
+func getRefreshToken(ctx context.Context, db querier, id uuid.UUID) (RefreshToken, error) {
 	query := `
-		SELECT token, created_at, updated_at, user_id, expires_at, revoked_at
+		SELECT id, token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, replaced_by
 		FROM refresh_tokens
-		WHERE token = ?
+		WHERE id = ?
 	`
 	var rt RefreshToken
 	var userID string
-	err := c.db.QueryRow(query, token).
-		Scan(&rt.Token, &rt.CreatedAt, &rt.UpdatedAt, &userID, &rt.ExpiresAt, &rt.RevokedAt)
+	err := db.QueryRowContext(ctx, query, id).
+		Scan(&rt.ID, &rt.TokenHash, &rt.CreatedAt, &rt.UpdatedAt, &userID, &rt.ExpiresAt, &rt.RevokedAt, &rt.FamilyID, &rt.ReplacedBy)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return RefreshToken{}, nil
+		if errors.Is(err, sql.ErrNoRows) {
+			return RefreshToken{}, ErrNotFound
 		}
 		return RefreshToken{}, err
 	}
@@ -73,11 +216,10 @@ func (c Client) GetRefreshToken(token string) (RefreshToken, error) {
 	return rt, nil
 }
 
-func (c Client) DeleteRefreshToken(token string) error {
+func (c Client) DeleteRefreshToken(ctx context.Context, id uuid.UUID) error {
 	query := `
 		DELETE FROM refresh_tokens
-		WHERE token = ?
+		WHERE id = ?
 	`
-	_, err := c.db.Exec(query, token)
-	return err
+	return requireRowsAffected(c.db.ExecContext(ctx, query, id))
 }
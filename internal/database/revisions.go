@@ -0,0 +1,436 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Revision kinds group the video fields that change together.
+const (
+	RevisionKindMetadata   = "metadata"
+	RevisionKindVideo      = "video"
+	RevisionKindThumbnail  = "thumbnail"
+	RevisionKindVisibility = "visibility"
+)
+
+// ErrNotMediaRevision is returned when rolling back to a metadata revision.
+var ErrNotMediaRevision = errors.New("only video and thumbnail revisions can be rolled back to")
+
+// RevisionChange holds a field's value before and after a revision.
+type RevisionChange struct {
+	Old *string `json:"old"`
+	New *string `json:"new"`
+}
+
+// VideoRevision records one change to a video. Changes holds every field of
+// the revision's kind, not only the ones that differ, so a media revision
+// can be restored as a whole.
+type VideoRevision struct {
+	ID        uuid.UUID                 `json:"id"`
+	CreatedAt time.Time                 `json:"created_at"`
+	VideoID   uuid.UUID                 `json:"video_id"`
+	Number    int                       `json:"number"`
+	Kind      string                    `json:"kind"`
+	Changes   map[string]RevisionChange `json:"changes"`
+	// RollbackOf is the revision this one restored, if any.
+	RollbackOf *uuid.UUID `json:"rollback_of"`
+	// UserID is who made the change, nil for changes made by the system.
+	UserID *uuid.UUID `json:"user_id"`
+}
+
+type revisionField struct {
+	name string
+	get  func(Video) *string
+	set  func(*Video, *string) error
+}
+
+var revisionFields = map[string][]revisionField{
+	RevisionKindMetadata: {
+		{"title", func(v Video) *string { return &v.Title }, func(v *Video, s *string) error { v.Title = deref(s); return nil }},
+		{"description", func(v Video) *string { return &v.Description }, func(v *Video, s *string) error { v.Description = deref(s); return nil }},
+	},
+	RevisionKindVideo: {
+		{"video_url", func(v Video) *string { return v.VideoURL }, func(v *Video, s *string) error { v.VideoURL = s; return nil }},
+		{"original_key", func(v Video) *string { return v.OriginalKey }, func(v *Video, s *string) error { v.OriginalKey = s; return nil }},
+		{"duration", func(v Video) *string { return formatFloat(v.Duration) }, func(v *Video, s *string) (err error) { v.Duration, err = parseFloat(s); return err }},
+		{"aspect_ratio", func(v Video) *string { return v.AspectRatio }, func(v *Video, s *string) error { v.AspectRatio = s; return nil }},
+		{"audio_url", func(v Video) *string { return v.AudioURL }, func(v *Video, s *string) error { v.AudioURL = s; return nil }},
+		{"audio_duration", func(v Video) *string { return formatFloat(v.AudioDuration) }, func(v *Video, s *string) (err error) { v.AudioDuration, err = parseFloat(s); return err }},
+	},
+	RevisionKindThumbnail: {
+		{"thumbnail_url", func(v Video) *string { return v.ThumbnailURL }, func(v *Video, s *string) error { v.ThumbnailURL = s; return nil }},
+	},
+	RevisionKindVisibility: {
+		{"visibility", func(v Video) *string { return &v.Visibility }, func(v *Video, s *string) error { v.Visibility = deref(s); return nil }},
+		{"publish_at", func(v Video) *string { return formatTime(v.PublishAt) }, func(v *Video, s *string) (err error) { v.PublishAt, err = parseTime(s); return err }},
+	},
+}
+
+// RevisionKinds lists every kind of revision, in the order a change that
+// spans several kinds records them.
+var RevisionKinds = []string{RevisionKindMetadata, RevisionKindVideo, RevisionKindThumbnail, RevisionKindVisibility}
+
+// RevisionChanges returns the changes of the given kind between two
+// versions of a video, or nil when none of its fields differ.
+func RevisionChanges(kind string, before, after Video) map[string]RevisionChange {
+	changes := map[string]RevisionChange{}
+	changed := false
+	for _, field := range revisionFields[kind] {
+		old, new := field.get(before), field.get(after)
+		if !equalPtr(old, new) {
+			changed = true
+		}
+		changes[field.name] = RevisionChange{Old: old, New: new}
+	}
+	if !changed {
+		return nil
+	}
+	return changes
+}
+
+// ApplyRevision sets the fields of a video to the state right after the
+// revision.
+func ApplyRevision(video *Video, revision VideoRevision) error {
+	for _, field := range revisionFields[revision.Kind] {
+		change, ok := revision.Changes[field.name]
+		if !ok {
+			continue
+		}
+		if err := field.set(video, change.New); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsMediaRevision reports whether a revision can be rolled back to.
+func IsMediaRevision(revision VideoRevision) bool {
+	return revision.Kind == RevisionKindVideo || revision.Kind == RevisionKindThumbnail
+}
+
+// ReviseVideoFile saves the processed file of video, its original, its
+// audio rendition and its processing status, and records a video revision
+// if any of them changed. Every other column is left alone, so a thumbnail
+// or metadata edit made while the video was processing is kept. userID is
+// the author, uuid.Nil for changes made by the system.
+func (c Client) ReviseVideoFile(ctx context.Context, video Video, userID uuid.UUID) (Video, error) {
+	return c.reviseVideo(ctx, RevisionKindVideo, video, userID)
+}
+
+// ReviseVideoThumbnail saves the thumbnail of video and records a thumbnail
+// revision if it changed. Every other column is left alone.
+func (c Client) ReviseVideoThumbnail(ctx context.Context, video Video, userID uuid.UUID) (Video, error) {
+	return c.reviseVideo(ctx, RevisionKindThumbnail, video, userID)
+}
+
+func (c Client) reviseVideo(ctx context.Context, kind string, video Video, userID uuid.UUID) (Video, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Video{}, err
+	}
+	defer tx.Rollback()
+
+	before, err := getVideoForUpdate(ctx, tx, video.ID)
+	if err != nil {
+		return Video{}, err
+	}
+	after := before
+	CopyVideoFields(kind, &after, video)
+	err = updateVideoFields(ctx, tx, kind, after)
+	if err != nil {
+		return Video{}, err
+	}
+	err = c.createRevisions(ctx, tx, before, after, userID, nil)
+	if err != nil {
+		return Video{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Video{}, err
+	}
+	return c.GetVideo(ctx, video.ID)
+}
+
+// CopyVideoFields sets the fields of dst that a media revision of the given
+// kind covers to those of src. The video kind also carries the processing
+// status, which changes along with the file.
+func CopyVideoFields(kind string, dst *Video, src Video) {
+	switch kind {
+	case RevisionKindVideo:
+		dst.VideoURL = src.VideoURL
+		dst.OriginalKey = src.OriginalKey
+		dst.Duration = src.Duration
+		dst.AspectRatio = src.AspectRatio
+		dst.AudioURL = src.AudioURL
+		dst.AudioDuration = src.AudioDuration
+		dst.ProcessingStatus = src.ProcessingStatus
+	case RevisionKindThumbnail:
+		dst.ThumbnailURL = src.ThumbnailURL
+	}
+}
+
+// updateVideoFields writes the columns CopyVideoFields copies for kind.
+func updateVideoFields(ctx context.Context, db execer, kind string, video Video) error {
+	switch kind {
+	case RevisionKindVideo:
+		query := `
+		UPDATE videos
+		SET
+			updated_at = CURRENT_TIMESTAMP,
+			version = version + 1,
+			video_url = ?,
+			original_key = ?,
+			duration = ?,
+			aspect_ratio = ?,
+			audio_url = ?,
+			audio_duration = ?,
+			processing_status = ?
+		WHERE id = ?
+		`
+		return requireRowsAffected(db.ExecContext(ctx,
+			query,
+			video.VideoURL,
+			video.OriginalKey,
+			video.Duration,
+			video.AspectRatio,
+			video.AudioURL,
+			video.AudioDuration,
+			video.ProcessingStatus,
+			video.ID,
+		))
+	case RevisionKindThumbnail:
+		query := `
+		UPDATE videos
+		SET updated_at = CURRENT_TIMESTAMP, version = version + 1, thumbnail_url = ?
+		WHERE id = ?
+		`
+		return requireRowsAffected(db.ExecContext(ctx, query, video.ThumbnailURL, video.ID))
+	}
+	return fmt.Errorf("unknown media revision kind %q", kind)
+}
+
+// GetVideoRevisions returns a video's revisions, newest first.
+func (c Client) GetVideoRevisions(ctx context.Context, videoID uuid.UUID) ([]VideoRevision, error) {
+	query := `
+	SELECT` + revisionColumns + `
+	FROM video_revisions
+	WHERE video_id = ?
+	ORDER BY number DESC
+	`
+	rows, err := c.db.QueryContext(ctx, query, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []VideoRevision{}
+	for rows.Next() {
+		revision, err := scanRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, rows.Err()
+}
+
+// RollbackVideoRevision restores the media fields of a video to how they
+// were right after the given revision, recording the rollback as a new
+// revision.
+func (c Client) RollbackVideoRevision(ctx context.Context, videoID, revisionID, userID uuid.UUID) (Video, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Video{}, err
+	}
+	defer tx.Rollback()
+
+	query := `
+	SELECT` + revisionColumns + `
+	FROM video_revisions
+	WHERE id = ? AND video_id = ?
+	`
+	revision, err := scanRevision(tx.QueryRowContext(ctx, query, revisionID, videoID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Video{}, ErrNotFound
+	}
+	if err != nil {
+		return Video{}, err
+	}
+	if !IsMediaRevision(revision) {
+		return Video{}, ErrNotMediaRevision
+	}
+
+	before, err := getVideoForUpdate(ctx, tx, videoID)
+	if err != nil {
+		return Video{}, err
+	}
+	after := before
+	err = ApplyRevision(&after, revision)
+	if err != nil {
+		return Video{}, err
+	}
+	err = updateVideoFields(ctx, tx, revision.Kind, after)
+	if err != nil {
+		return Video{}, err
+	}
+	err = c.createRevisions(ctx, tx, before, after, userID, &revision.ID)
+	if err != nil {
+		return Video{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Video{}, err
+	}
+	return c.GetVideo(ctx, videoID)
+}
+
+const revisionColumns = `
+		id,
+		created_at,
+		video_id,
+		number,
+		kind,
+		changes,
+		rollback_of,
+		user_id`
+
+func scanRevision(row interface{ Scan(...interface{}) error }) (VideoRevision, error) {
+	var revision VideoRevision
+	var changes string
+	var rollbackOf, userID uuid.NullUUID
+	err := row.Scan(
+		&revision.ID,
+		&revision.CreatedAt,
+		&revision.VideoID,
+		&revision.Number,
+		&revision.Kind,
+		&changes,
+		&rollbackOf,
+		&userID,
+	)
+	if err != nil {
+		return VideoRevision{}, err
+	}
+	if rollbackOf.Valid {
+		revision.RollbackOf = &rollbackOf.UUID
+	}
+	if userID.Valid {
+		revision.UserID = &userID.UUID
+	}
+	err = json.Unmarshal([]byte(changes), &revision.Changes)
+	return revision, err
+}
+
+// getVideoForUpdate reads a video that isn't in the trash inside tx and
+// locks its row until tx ends, so concurrent edits of the video wait for
+// each other.
+func getVideoForUpdate(ctx context.Context, tx *tx, id uuid.UUID) (Video, error) {
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	WHERE id = ? AND deleted_at IS NULL` + tx.dialect.forUpdate()
+	video, err := scanVideo(tx.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Video{}, ErrNotFound
+	}
+	return video, err
+}
+
+func (c Client) createRevisions(ctx context.Context, tx *tx, before, after Video, userID uuid.UUID, rollbackOf *uuid.UUID) error {
+	author := uuid.NullUUID{UUID: userID, Valid: userID != uuid.Nil}
+	for _, kind := range RevisionKinds {
+		changes := RevisionChanges(kind, before, after)
+		if changes == nil {
+			continue
+		}
+		data, err := json.Marshal(changes)
+		if err != nil {
+			return err
+		}
+
+		// The caller holds the video's row lock from getVideoForUpdate, so
+		// no other transaction can take the same number
+		var number int
+		err = tx.QueryRowContext(ctx, "SELECT COALESCE(MAX(number), 0) + 1 FROM video_revisions WHERE video_id = ?", after.ID).Scan(&number)
+		if err != nil {
+			return err
+		}
+
+		query := `
+		INSERT INTO video_revisions (
+			id,
+			created_at,
+			video_id,
+			number,
+			kind,
+			changes,
+			rollback_of,
+			user_id
+		) VALUES (?, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?, ?)
+		`
+		_, err = tx.ExecContext(ctx, query, uuid.New(), after.ID, number, kind, string(data), rollbackOf, author)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func equalPtr(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func formatFloat(f *float64) *string {
+	if f == nil {
+		return nil
+	}
+	s := strconv.FormatFloat(*f, 'f', -1, 64)
+	return &s
+}
+
+func parseFloat(s *string) (*float64, error) {
+	if s == nil {
+		return nil, nil
+	}
+	f, err := strconv.ParseFloat(*s, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+func formatTime(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	s := t.UTC().Format(time.RFC3339Nano)
+	return &s
+}
+
+func parseTime(s *string) (*time.Time, error) {
+	if s == nil {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, *s)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
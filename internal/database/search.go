@@ -0,0 +1,237 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"unicode"
+
+	"github.com/google/uuid"
+)
+
+// Highlighted search matches are wrapped in these control characters so
+// callers can escape the surrounding text before marking them up.
+const (
+	HighlightStart = "\x02"
+	HighlightEnd   = "\x03"
+)
+
+// ErrEmptySearch is returned when a search query has no searchable terms.
+var ErrEmptySearch = errors.New("search query has no terms")
+
+type SearchVideosParams struct {
+	UserID uuid.UUID
+	Query  string
+	Limit  int
+	Offset int
+}
+
+type VideoSearchResult struct {
+	Video
+	Rank float64 `json:"rank"`
+	// TitleHighlight and Snippet mark matches with HighlightStart and
+	// HighlightEnd.
+	TitleHighlight string `json:"title_highlight"`
+	Snippet        string `json:"snippet"`
+}
+
+type VideoSearchPage struct {
+	Results []VideoSearchResult
+	Total   int
+}
+
+// SearchTerms splits a search query into lower-cased words, dropping
+// punctuation and anything else the full-text query syntax would treat
+// as an operator.
+func SearchTerms(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+type searchHit struct {
+	videoID        uuid.UUID
+	rank           float64
+	titleHighlight string
+	snippet        string
+}
+
+// SearchVideos returns a user's videos whose title or description match
+// every term of the query, best matches first. The last term also matches
+// as a prefix so results can be shown while the user is typing.
+func (c Client) SearchVideos(ctx context.Context, params SearchVideosParams) (VideoSearchPage, error) {
+	terms := SearchTerms(params.Query)
+	if len(terms) == 0 {
+		return VideoSearchPage{}, ErrEmptySearch
+	}
+	if params.Limit <= 0 {
+		params.Limit = DefaultVideoPageSize
+	}
+
+	var hits []searchHit
+	var total int
+	var err error
+	if c.db.dialect == dialectPostgres {
+		hits, total, err = c.searchPostgres(ctx, params, terms)
+	} else {
+		hits, total, err = c.searchSQLite(ctx, params, terms)
+	}
+	if err != nil {
+		return VideoSearchPage{}, err
+	}
+
+	videos, err := c.getVideosByID(ctx, hits)
+	if err != nil {
+		return VideoSearchPage{}, err
+	}
+
+	page := VideoSearchPage{
+		Results: []VideoSearchResult{},
+		Total:   total,
+	}
+	for _, hit := range hits {
+		video, ok := videos[hit.videoID]
+		if !ok {
+			continue
+		}
+		page.Results = append(page.Results, VideoSearchResult{
+			Video:          video,
+			Rank:           hit.rank,
+			TitleHighlight: hit.titleHighlight,
+			Snippet:        hit.snippet,
+		})
+	}
+	return page, nil
+}
+
+// getVideosByID loads the videos of a page of search hits, with their tags,
+// in a single query.
+func (c Client) getVideosByID(ctx context.Context, hits []searchHit) (map[uuid.UUID]Video, error) {
+	byID := map[uuid.UUID]Video{}
+	if len(hits) == 0 {
+		return byID, nil
+	}
+
+	placeholders := make([]string, len(hits))
+	args := make([]interface{}, len(hits))
+	for i, hit := range hits {
+		placeholders[i] = "?"
+		args[i] = hit.videoID
+	}
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	WHERE id IN (` + strings.Join(placeholders, ", ") + `) AND deleted_at IS NULL
+	`
+	videos, err := c.queryVideos(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	err = c.loadVideoTags(ctx, videos)
+	if err != nil {
+		return nil, err
+	}
+	for _, video := range videos {
+		byID[video.ID] = video
+	}
+	return byID, nil
+}
+
+func (c Client) searchPostgres(ctx context.Context, params SearchVideosParams, terms []string) ([]searchHit, int, error) {
+	terms[len(terms)-1] += ":*"
+	tsquery := strings.Join(terms, " & ")
+
+	var total int
+	countQuery := `
+	SELECT COUNT(*)
+	FROM videos
+	WHERE user_id = ? AND deleted_at IS NULL AND search_vector @@ to_tsquery('english', ?)
+	`
+	err := c.db.QueryRowContext(ctx, countQuery, params.UserID, tsquery).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := `
+	SELECT
+		id,
+		ts_rank_cd(search_vector, query) AS rank,
+		ts_headline('english', title, query,
+			'HighlightAll=true, StartSel=' || chr(2) || ', StopSel=' || chr(3)),
+		ts_headline('english', coalesce(description, ''), query,
+			'MaxWords=24, MinWords=8, StartSel=' || chr(2) || ', StopSel=' || chr(3))
+	FROM videos, to_tsquery('english', ?) query
+	WHERE user_id = ? AND deleted_at IS NULL AND search_vector @@ query
+	ORDER BY rank DESC, created_at DESC
+	LIMIT ? OFFSET ?
+	`
+	rows, err := c.db.QueryContext(ctx, query, tsquery, params.UserID, params.Limit, params.Offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	hits := []searchHit{}
+	for rows.Next() {
+		var hit searchHit
+		if err := rows.Scan(&hit.videoID, &hit.rank, &hit.titleHighlight, &hit.snippet); err != nil {
+			return nil, 0, err
+		}
+		hits = append(hits, hit)
+	}
+	return hits, total, rows.Err()
+}
+
+// searchSQLite ranks matches with FTS5's bm25(), weighing title matches
+// twice as much as description matches. bm25() scores better matches
+// lower, so the rank is negated to sort the same way as Postgres.
+func (c Client) searchSQLite(ctx context.Context, params SearchVideosParams, terms []string) ([]searchHit, int, error) {
+	// Quoting each term keeps FTS5 from reading it as an operator or
+	// column filter
+	phrases := make([]string, len(terms))
+	for i, term := range terms {
+		phrases[i] = `"` + term + `"`
+	}
+	phrases[len(phrases)-1] += "*"
+	match := strings.Join(phrases, " ")
+
+	var total int
+	countQuery := `
+	SELECT COUNT(*)
+	FROM videos_fts
+	JOIN videos ON videos.id = videos_fts.video_id
+	WHERE videos_fts MATCH ? AND videos.user_id = ? AND videos.deleted_at IS NULL
+	`
+	err := c.db.QueryRowContext(ctx, countQuery, match, params.UserID).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := `
+	SELECT
+		videos_fts.video_id,
+		-bm25(videos_fts, 0.0, 2.0, 1.0) AS score,
+		highlight(videos_fts, 1, char(2), char(3)),
+		snippet(videos_fts, 2, char(2), char(3), '…', 24)
+	FROM videos_fts
+	JOIN videos ON videos.id = videos_fts.video_id
+	WHERE videos_fts MATCH ? AND videos.user_id = ? AND videos.deleted_at IS NULL
+	ORDER BY score DESC, videos.created_at DESC
+	LIMIT ? OFFSET ?
+	`
+	rows, err := c.db.QueryContext(ctx, query, match, params.UserID, params.Limit, params.Offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	hits := []searchHit{}
+	for rows.Next() {
+		var hit searchHit
+		if err := rows.Scan(&hit.videoID, &hit.rank, &hit.titleHighlight, &hit.snippet); err != nil {
+			return nil, 0, err
+		}
+		hits = append(hits, hit)
+	}
+	return hits, total, rows.Err()
+}
@@ -0,0 +1,164 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Session is one login on one client. Its ID is the FamilyID of the refresh
+// tokens rotated from that login.
+type Session struct {
+	ID         uuid.UUID `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	UserID     uuid.UUID `json:"user_id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+}
+
+func (c Client) createSession(ctx context.Context, tx *tx, params CreateRefreshTokenParams) error {
+	query := `
+		INSERT INTO sessions (
+			id,
+			created_at,
+			last_used_at,
+			expires_at,
+			user_id,
+			user_agent,
+			ip
+		) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?)
+	`
+	_, err := tx.ExecContext(ctx, query, params.FamilyID, c.db.dialect.timestamp(params.ExpiresAt), params.UserID, params.UserAgent, params.IP)
+	return err
+}
+
+// touchSession records that a session's refresh token was rotated, and
+// from which client.
+func (c Client) touchSession(ctx context.Context, tx *tx, params CreateRefreshTokenParams) error {
+	query := `
+		UPDATE sessions
+		SET last_used_at = CURRENT_TIMESTAMP, expires_at = ?, user_agent = ?, ip = ?
+		WHERE id = ?
+	`
+	_, err := tx.ExecContext(ctx, query, c.db.dialect.timestamp(params.ExpiresAt), params.UserAgent, params.IP, params.FamilyID)
+	return err
+}
+
+// GetSessions returns a user's sessions that haven't been revoked or
+// expired, most recently used first.
+func (c Client) GetSessions(ctx context.Context, userID uuid.UUID) ([]Session, error) {
+	query := `
+		SELECT id, created_at, last_used_at, expires_at, user_id, user_agent, ip
+		FROM sessions
+		WHERE user_id = ? AND revoked_at IS NULL
+		ORDER BY last_used_at DESC
+	`
+	rows, err := c.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	sessions := []Session{}
+	for rows.Next() {
+		var session Session
+		err := rows.Scan(
+			&session.ID,
+			&session.CreatedAt,
+			&session.LastUsedAt,
+			&session.ExpiresAt,
+			&session.UserID,
+			&session.UserAgent,
+			&session.IP,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if now.Before(session.ExpiresAt) {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions, rows.Err()
+}
+
+// RevokeSession logs out one of a user's sessions. It returns ErrNotFound
+// if the session isn't theirs or was already revoked.
+func (c Client) RevokeSession(ctx context.Context, userID, id uuid.UUID) error {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT COUNT(*)
+		FROM sessions
+		WHERE id = ? AND user_id = ? AND revoked_at IS NULL
+	`
+	var count int
+	err = tx.QueryRowContext(ctx, query, id, userID).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotFound
+	}
+	err = revokeSession(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RevokeSessions logs a user out everywhere.
+func (c Client) RevokeSessions(ctx context.Context, userID uuid.UUID) error {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE sessions
+		SET revoked_at = CURRENT_TIMESTAMP
+		WHERE user_id = ? AND revoked_at IS NULL
+	`
+	_, err = tx.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	query = `
+		UPDATE refresh_tokens
+		SET revoked_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE user_id = ? AND revoked_at IS NULL
+	`
+	_, err = tx.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// revokeSession revokes a session and every refresh token in it.
+func revokeSession(ctx context.Context, tx *tx, id uuid.UUID) error {
+	query := `
+		UPDATE sessions
+		SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND revoked_at IS NULL
+	`
+	_, err := tx.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	query = `
+		UPDATE refresh_tokens
+		SET revoked_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE family_id = ? AND revoked_at IS NULL
+	`
+	_, err = tx.ExecContext(ctx, query, id)
+	return err
+}
@@ -0,0 +1,127 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type UserStore interface {
+	GetUsers(ctx context.Context) ([]User, error)
+	GetUser(ctx context.Context, id uuid.UUID) (*User, error)
+	GetUserByEmail(ctx context.Context, email string) (User, error)
+	CreateUser(ctx context.Context, params CreateUserParams) (*User, error)
+	UpdateUserPassword(ctx context.Context, id uuid.UUID, password string) error
+	DeleteUser(ctx context.Context, id uuid.UUID) error
+}
+
+// VideoStore covers videos and the tags, captions, chapters and fingerprints
+// that belong to them.
+type VideoStore interface {
+	GetVideos(ctx context.Context, params GetVideosParams) (VideoPage, error)
+	GetVideosWithOriginals(ctx context.Context) ([]Video, error)
+	GetVideo(ctx context.Context, id uuid.UUID) (Video, error)
+	CreateVideo(ctx context.Context, params CreateVideoParams) (Video, error)
+	UpdateVideo(ctx context.Context, video Video) error
+	UpdateVideoMetadata(ctx context.Context, id uuid.UUID, params UpdateVideoMetadataParams) (Video, error)
+	UpdateVideoVisibility(ctx context.Context, id uuid.UUID, params UpdateVideoVisibilityParams) (Video, error)
+	SetVideoProcessingStatus(ctx context.Context, id uuid.UUID, status string) error
+	DeleteVideo(ctx context.Context, id uuid.UUID) error
+	SearchVideos(ctx context.Context, params SearchVideosParams) (VideoSearchPage, error)
+
+	TrashVideo(ctx context.Context, id uuid.UUID) error
+	RestoreVideo(ctx context.Context, id uuid.UUID) error
+	GetTrashedVideo(ctx context.Context, id uuid.UUID) (Video, error)
+	GetTrashedVideos(ctx context.Context, userID uuid.UUID) ([]Video, error)
+	GetVideosTrashedBefore(ctx context.Context, before time.Time) ([]Video, error)
+
+	ReviseVideoFile(ctx context.Context, video Video, userID uuid.UUID) (Video, error)
+	ReviseVideoThumbnail(ctx context.Context, video Video, userID uuid.UUID) (Video, error)
+	GetVideoRevisions(ctx context.Context, videoID uuid.UUID) ([]VideoRevision, error)
+	RollbackVideoRevision(ctx context.Context, videoID, revisionID, userID uuid.UUID) (Video, error)
+
+	RecordPlaybackEvent(ctx context.Context, event PlaybackEvent) error
+	GetVideoDailyStats(ctx context.Context, videoID uuid.UUID, from, to time.Time) ([]VideoDailyStats, error)
+	GetPlaybackPositions(ctx context.Context, videoID uuid.UUID, from, to time.Time) ([]float64, error)
+
+	GetVideoReaction(ctx context.Context, videoID, userID uuid.UUID) (string, error)
+	SetVideoReaction(ctx context.Context, videoID, userID uuid.UUID, reaction string) error
+	DeleteVideoReaction(ctx context.Context, videoID, userID uuid.UUID) error
+
+	GetCaption(ctx context.Context, videoID uuid.UUID, language string) (Caption, error)
+	GetCaptions(ctx context.Context, videoID uuid.UUID) ([]Caption, error)
+	UpsertCaption(ctx context.Context, params CreateCaptionParams) (Caption, error)
+	DeleteCaption(ctx context.Context, videoID uuid.UUID, language string) error
+
+	GetTags(ctx context.Context, params GetTagsParams) ([]TagCount, error)
+	SetVideoTags(ctx context.Context, videoID uuid.UUID, tags []string) ([]string, error)
+
+	GetChapters(ctx context.Context, videoID uuid.UUID) ([]Chapter, error)
+	ReplaceChapters(ctx context.Context, videoID uuid.UUID, params []CreateChapterParams) ([]Chapter, error)
+
+	SaveFingerprint(ctx context.Context, fp Fingerprint) error
+	FindFingerprints(ctx context.Context, filter FingerprintFilter) ([]Fingerprint, error)
+}
+
+type PlaylistStore interface {
+	GetPlaylists(ctx context.Context, userID uuid.UUID) ([]Playlist, error)
+	GetPlaylist(ctx context.Context, id uuid.UUID) (Playlist, error)
+	CreatePlaylist(ctx context.Context, params CreatePlaylistParams) (Playlist, error)
+	UpdatePlaylist(ctx context.Context, playlist Playlist) error
+	DeletePlaylist(ctx context.Context, id uuid.UUID) error
+
+	GetPlaylistItems(ctx context.Context, playlistID uuid.UUID) ([]PlaylistItem, error)
+	AddPlaylistItem(ctx context.Context, playlistID, videoID uuid.UUID, position *int) (PlaylistItem, error)
+	MovePlaylistItem(ctx context.Context, playlistID, itemID uuid.UUID, position int) error
+	ReorderPlaylistItems(ctx context.Context, playlistID uuid.UUID, itemIDs []uuid.UUID) error
+	RemovePlaylistItem(ctx context.Context, playlistID, itemID uuid.UUID) error
+}
+
+// CommentStore covers comments on videos and their replies.
+type CommentStore interface {
+	CreateComment(ctx context.Context, params CreateCommentParams, limits ...CommentRateLimit) (Comment, error)
+	GetComment(ctx context.Context, id uuid.UUID) (Comment, error)
+	GetComments(ctx context.Context, params GetCommentsParams) (CommentPage, error)
+	UpdateComment(ctx context.Context, id uuid.UUID, body string) (Comment, error)
+	DeleteComment(ctx context.Context, id uuid.UUID) error
+	PinComment(ctx context.Context, id uuid.UUID, pinned bool) error
+	SetCommentsDisabled(ctx context.Context, videoID uuid.UUID, disabled bool) (Video, error)
+}
+
+// PublishingStore covers scheduled publishing and the webhooks it sends.
+type PublishingStore interface {
+	PublishDueVideos(ctx context.Context, now time.Time, webhookURLs []string) ([]Video, error)
+	GetDueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]WebhookDelivery, error)
+	MarkWebhookDelivered(ctx context.Context, id uuid.UUID) error
+	MarkWebhookFailed(ctx context.Context, id uuid.UUID, lastError string, nextAttemptAt *time.Time) error
+}
+
+type RefreshTokenStore interface {
+	GetRefreshToken(ctx context.Context, id uuid.UUID) (RefreshToken, error)
+	CreateRefreshToken(ctx context.Context, params CreateRefreshTokenParams) (RefreshToken, error)
+	RotateRefreshToken(ctx context.Context, id uuid.UUID, params CreateRefreshTokenParams) (RefreshToken, error)
+	RevokeRefreshToken(ctx context.Context, id uuid.UUID) error
+	DeleteRefreshToken(ctx context.Context, id uuid.UUID) error
+}
+
+type SessionStore interface {
+	GetSessions(ctx context.Context, userID uuid.UUID) ([]Session, error)
+	RevokeSession(ctx context.Context, userID, id uuid.UUID) error
+	RevokeSessions(ctx context.Context, userID uuid.UUID) error
+}
+
+// Store is everything the API needs from persistence. Client implements it
+// on top of SQL and the memstore package keeps it in memory for tests.
+type Store interface {
+	UserStore
+	VideoStore
+	PlaylistStore
+	CommentStore
+	PublishingStore
+	RefreshTokenStore
+	SessionStore
+	Reset(ctx context.Context) error
+}
+
+var _ Store = Client{}
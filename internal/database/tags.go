@@ -0,0 +1,207 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// TagCount is one of a user's tags with the number of videos carrying it.
+type TagCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+type GetTagsParams struct {
+	UserID uuid.UUID
+	// Prefix limits the result to tags starting with it, for autocomplete.
+	Prefix string
+	Limit  int
+}
+
+// GetTags returns a user's tags, most used first.
+func (c Client) GetTags(ctx context.Context, params GetTagsParams) ([]TagCount, error) {
+	query := `
+	SELECT tags.name, COUNT(video_tags.video_id)
+	FROM tags
+	JOIN video_tags ON video_tags.tag_id = tags.id
+	JOIN videos ON videos.id = video_tags.video_id
+	WHERE tags.user_id = ? AND videos.deleted_at IS NULL
+	`
+	args := []interface{}{params.UserID}
+	if params.Prefix != "" {
+		query += " AND tags.name LIKE ? ESCAPE '\\'"
+		args = append(args, escapeLike(params.Prefix)+"%")
+	}
+	query += " GROUP BY tags.name ORDER BY COUNT(video_tags.video_id) DESC, tags.name"
+	if params.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, params.Limit)
+	}
+
+	rows, err := c.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []TagCount{}
+	for rows.Next() {
+		var tag TagCount
+		if err := rows.Scan(&tag.Name, &tag.Count); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+// SetVideoTags replaces the tags of a video. Tags no longer used by any of
+// the owner's videos are removed.
+func (c Client) SetVideoTags(ctx context.Context, videoID uuid.UUID, tags []string) ([]string, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var userID uuid.UUID
+	err = tx.QueryRowContext(ctx, "SELECT user_id FROM videos WHERE id = ?", videoID).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = setVideoTags(ctx, tx, videoID, userID, tags)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return c.getVideoTags(ctx, videoID)
+}
+
+func setVideoTags(ctx context.Context, tx *tx, videoID, userID uuid.UUID, tags []string) error {
+	_, err := tx.ExecContext(ctx, "DELETE FROM video_tags WHERE video_id = ?", videoID)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range tags {
+		query := `
+		INSERT INTO tags (id, created_at, user_id, name)
+		VALUES (?, CURRENT_TIMESTAMP, ?, ?)
+		ON CONFLICT (user_id, name) DO NOTHING
+		`
+		_, err = tx.ExecContext(ctx, query, uuid.New(), userID, name)
+		if err != nil {
+			return err
+		}
+
+		var tagID uuid.UUID
+		err = tx.QueryRowContext(ctx, "SELECT id FROM tags WHERE user_id = ? AND name = ?", userID, name).Scan(&tagID)
+		if err != nil {
+			return err
+		}
+
+		query = `
+		INSERT INTO video_tags (video_id, tag_id)
+		VALUES (?, ?)
+		ON CONFLICT (video_id, tag_id) DO NOTHING
+		`
+		_, err = tx.ExecContext(ctx, query, videoID, tagID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return deleteUnusedTags(ctx, tx, userID)
+}
+
+func deleteUnusedTags(ctx context.Context, tx *tx, userID uuid.UUID) error {
+	query := `
+	DELETE FROM tags
+	WHERE user_id = ? AND id NOT IN (SELECT tag_id FROM video_tags)
+	`
+	_, err := tx.ExecContext(ctx, query, userID)
+	return err
+}
+
+func (c Client) getVideoTags(ctx context.Context, videoID uuid.UUID) ([]string, error) {
+	query := `
+	SELECT tags.name
+	FROM video_tags
+	JOIN tags ON tags.id = video_tags.tag_id
+	WHERE video_tags.video_id = ?
+	ORDER BY tags.name
+	`
+	rows, err := c.db.QueryContext(ctx, query, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		tags = append(tags, name)
+	}
+	return tags, rows.Err()
+}
+
+// loadVideoTags fills in the tags of a page of videos with a single query.
+func (c Client) loadVideoTags(ctx context.Context, videos []Video) error {
+	if len(videos) == 0 {
+		return nil
+	}
+
+	index := map[uuid.UUID]int{}
+	placeholders := make([]string, len(videos))
+	args := make([]interface{}, len(videos))
+	for i := range videos {
+		videos[i].Tags = []string{}
+		index[videos[i].ID] = i
+		placeholders[i] = "?"
+		args[i] = videos[i].ID
+	}
+
+	query := `
+	SELECT video_tags.video_id, tags.name
+	FROM video_tags
+	JOIN tags ON tags.id = video_tags.tag_id
+	WHERE video_tags.video_id IN (` + strings.Join(placeholders, ", ") + `)
+	ORDER BY tags.name
+	`
+	rows, err := c.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var videoID uuid.UUID
+		var name string
+		if err := rows.Scan(&videoID, &name); err != nil {
+			return err
+		}
+		i := index[videoID]
+		videos[i].Tags = append(videos[i].Tags, name)
+	}
+	return rows.Err()
+}
+
+// escapeLike escapes the LIKE wildcards in s so it matches literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,87 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TrashVideo moves a video to the trash. Trashed videos are hidden from
+// GetVideo, listings, playlists and search, and aren't published on
+// schedule, until restored or purged. Restoring brings back its playlist
+// items and schedule as they were.
+func (c Client) TrashVideo(ctx context.Context, id uuid.UUID) error {
+	query := `
+	UPDATE videos
+	SET deleted_at = CURRENT_TIMESTAMP, version = version + 1
+	WHERE id = ? AND deleted_at IS NULL
+	`
+	return requireRowsAffected(c.db.ExecContext(ctx, query, id))
+}
+
+// RestoreVideo takes a video back out of the trash.
+func (c Client) RestoreVideo(ctx context.Context, id uuid.UUID) error {
+	query := `
+	UPDATE videos
+	SET deleted_at = NULL, updated_at = CURRENT_TIMESTAMP, version = version + 1
+	WHERE id = ? AND deleted_at IS NOT NULL
+	`
+	return requireRowsAffected(c.db.ExecContext(ctx, query, id))
+}
+
+// GetTrashedVideo returns a video only if it is in the trash.
+func (c Client) GetTrashedVideo(ctx context.Context, id uuid.UUID) (Video, error) {
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	WHERE id = ? AND deleted_at IS NOT NULL
+	`
+	video, err := scanVideo(c.db.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Video{}, ErrNotFound
+	}
+	if err != nil {
+		return Video{}, err
+	}
+
+	video.Tags, err = c.getVideoTags(ctx, id)
+	if err != nil {
+		return Video{}, err
+	}
+	return video, nil
+}
+
+// GetTrashedVideos returns a user's trashed videos, most recently deleted
+// first.
+func (c Client) GetTrashedVideos(ctx context.Context, userID uuid.UUID) ([]Video, error) {
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	WHERE user_id = ? AND deleted_at IS NOT NULL
+	ORDER BY deleted_at DESC
+	`
+	videos, err := c.queryVideos(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	err = c.loadVideoTags(ctx, videos)
+	if err != nil {
+		return nil, err
+	}
+	return videos, nil
+}
+
+// GetVideosTrashedBefore returns every video that went into the trash
+// before the given time, for purging.
+func (c Client) GetVideosTrashedBefore(ctx context.Context, before time.Time) ([]Video, error) {
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	WHERE deleted_at IS NOT NULL AND deleted_at < ?
+	ORDER BY deleted_at
+	`
+	return c.queryVideos(ctx, query, c.db.dialect.timestamp(before))
+}
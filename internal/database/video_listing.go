@@ -0,0 +1,187 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultVideoPageSize = 20
+	MaxVideoPageSize     = 100
+)
+
+// ErrInvalidCursor is returned when a pagination cursor can't be decoded or
+// was issued for a different sort order.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+type VideoSort string
+
+const (
+	VideoSortCreatedAt VideoSort = "created_at"
+	VideoSortUpdatedAt VideoSort = "updated_at"
+	VideoSortTitle     VideoSort = "title"
+)
+
+// GetVideosParams selects videos by owner, visibility or both. At least one
+// of UserID and Visibility must be set.
+type GetVideosParams struct {
+	UserID     uuid.UUID
+	Visibility string
+	Limit      int
+	// Cursor is the NextCursor of the previous page, empty for the first.
+	Cursor     string
+	Sort       VideoSort
+	Descending bool
+
+	HasVideo         *bool
+	HasThumbnail     *bool
+	AspectRatio      string
+	ProcessingStatus string
+	CreatedAfter     *time.Time
+	CreatedBefore    *time.Time
+	Tag              string
+}
+
+type VideoPage struct {
+	Videos     []Video
+	NextCursor string
+	Total      int
+}
+
+func (p GetVideosParams) withDefaults() GetVideosParams {
+	if p.Limit == 0 {
+		p.Limit = DefaultVideoPageSize
+	}
+	if p.Sort == "" {
+		p.Sort = VideoSortCreatedAt
+		p.Descending = true
+	}
+	return p
+}
+
+func (p GetVideosParams) Validate() error {
+	if p.UserID == uuid.Nil && p.Visibility == "" {
+		return errors.New("videos must be listed by user or visibility")
+	}
+	if p.Limit < 0 || p.Limit > MaxVideoPageSize {
+		return fmt.Errorf("limit must be between 1 and %d", MaxVideoPageSize)
+	}
+	switch p.Sort {
+	case "", VideoSortCreatedAt, VideoSortUpdatedAt, VideoSortTitle:
+	default:
+		return fmt.Errorf("unsupported sort %q", p.Sort)
+	}
+	switch p.Visibility {
+	case "", VisibilityPrivate, VisibilityUnlisted, VisibilityPublic:
+	default:
+		return fmt.Errorf("unsupported visibility %q", p.Visibility)
+	}
+	switch p.ProcessingStatus {
+	case "", ProcessingStatusPending, ProcessingStatusProcessing, ProcessingStatusReady, ProcessingStatusFailed:
+	default:
+		return fmt.Errorf("unsupported processing status %q", p.ProcessingStatus)
+	}
+	return nil
+}
+
+// videoCursor points just past the last video of a page. It records the sort
+// it was issued for so it can't be replayed against a different ordering.
+type videoCursor struct {
+	Sort       VideoSort `json:"s"`
+	Descending bool      `json:"d"`
+	Value      string    `json:"v"`
+	ID         uuid.UUID `json:"id"`
+}
+
+func encodeVideoCursor(last Video, params GetVideosParams) string {
+	cursor := videoCursor{
+		Sort:       params.Sort,
+		Descending: params.Descending,
+		Value:      VideoSortValue(last, params.Sort),
+		ID:         last.ID,
+	}
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeVideoCursor(s string, params GetVideosParams) (videoCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return videoCursor{}, ErrInvalidCursor
+	}
+	var cursor videoCursor
+	err = json.Unmarshal(data, &cursor)
+	if err != nil {
+		return videoCursor{}, ErrInvalidCursor
+	}
+	if cursor.Sort != params.Sort || cursor.Descending != params.Descending {
+		return videoCursor{}, ErrInvalidCursor
+	}
+	return cursor, nil
+}
+
+// VideoSortValue returns the value a video is ordered by, formatted so that
+// values of the same sort compare correctly as strings.
+func VideoSortValue(video Video, sort VideoSort) string {
+	switch sort {
+	case VideoSortUpdatedAt:
+		return video.UpdatedAt.UTC().Format(time.RFC3339Nano)
+	case VideoSortTitle:
+		return video.Title
+	default:
+		return video.CreatedAt.UTC().Format(time.RFC3339Nano)
+	}
+}
+
+// PageVideos applies cursor pagination to videos that are already filtered
+// and sorted by params. It lets other Store implementations share the cursor
+// format used by Client.
+func PageVideos(videos []Video, params GetVideosParams) (VideoPage, error) {
+	params = params.withDefaults()
+	if err := params.Validate(); err != nil {
+		return VideoPage{}, err
+	}
+
+	page := VideoPage{Total: len(videos)}
+	if params.Cursor != "" {
+		cursor, err := decodeVideoCursor(params.Cursor, params)
+		if err != nil {
+			return VideoPage{}, err
+		}
+		start := len(videos)
+		for i, video := range videos {
+			if videoAfterCursor(video, cursor) {
+				start = i
+				break
+			}
+		}
+		videos = videos[start:]
+	}
+
+	page.Videos = videos
+	if len(videos) > params.Limit {
+		page.Videos = videos[:params.Limit]
+		page.NextCursor = encodeVideoCursor(page.Videos[params.Limit-1], params)
+	}
+	return page, nil
+}
+
+func videoAfterCursor(video Video, cursor videoCursor) bool {
+	value := VideoSortValue(video, cursor.Sort)
+	if value == cursor.Value {
+		value, cursorValue := video.ID.String(), cursor.ID.String()
+		if cursor.Descending {
+			return value < cursorValue
+		}
+		return value > cursorValue
+	}
+	if cursor.Descending {
+		return value < cursor.Value
+	}
+	return value > cursor.Value
+}
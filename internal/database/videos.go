@@ -1,45 +1,127 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+const (
+	ProcessingStatusPending    = "pending"
+	ProcessingStatusProcessing = "processing"
+	ProcessingStatusReady      = "ready"
+	ProcessingStatusFailed     = "failed"
+)
+
 type Video struct {
-	ID           uuid.UUID `json:"id"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-	ThumbnailURL *string   `json:"thumbnail_url"`
-	VideoURL     *string   `json:"video_url"`
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Version goes up by one on every write to the video's own fields, and
+	// is what its ETag is made of. Reaction counters don't change it.
+	Version          int      `json:"version"`
+	ThumbnailURL     *string  `json:"thumbnail_url"`
+	VideoURL         *string  `json:"video_url"`
+	Duration         *float64 `json:"duration"`
+	OriginalKey      *string  `json:"-"`
+	AudioURL         *string  `json:"audio_url"`
+	AudioDuration    *float64 `json:"audio_duration"`
+	AspectRatio      *string  `json:"aspect_ratio"`
+	ProcessingStatus string   `json:"processing_status"`
+	// DeletedAt is set while the video is in the trash.
+	DeletedAt        *time.Time `json:"deleted_at"`
+	CommentsDisabled bool       `json:"comments_disabled"`
+	// Reactions counts each reaction in the Reactions set. The counters are
+	// maintained by SetVideoReaction and DeleteVideoReaction, UpdateVideo
+	// leaves them alone.
+	Reactions map[string]int `json:"reactions"`
 	CreateVideoParams
 }
 
 type CreateVideoParams struct {
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	UserID      uuid.UUID `json:"user_id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Visibility  string `json:"visibility"`
+	// PublishAt is when a private video becomes public, nil when it isn't
+	// scheduled.
+	PublishAt *time.Time `json:"publish_at"`
+	UserID    uuid.UUID  `json:"user_id"`
+	// Tags are stored separately, UpdateVideo leaves them alone. Use
+	// SetVideoTags to change them.
+	Tags []string `json:"tags"`
 }
 
-func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
-	query := `
-	SELECT
+// videoColumns lists the columns read by scanVideo, in order.
+const videoColumns = `
 		id,
 		created_at,
 		updated_at,
+		version,
 		title,
 		description,
 		thumbnail_url,
 		video_url,
-		user_id
-	FROM videos
-	WHERE user_id = ?
-	ORDER BY created_at DESC
-	`
+		duration,
+		original_key,
+		audio_url,
+		audio_duration,
+		aspect_ratio,
+		processing_status,
+		visibility,
+		publish_at,
+		deleted_at,
+		comments_disabled,
+		user_id,
+		like_count,
+		dislike_count,
+		love_count,
+		laugh_count,
+		wow_count,
+		sad_count,
+		angry_count`
 
-	rows, err := c.db.Query(query, userID)
+func scanVideo(row interface{ Scan(...interface{}) error }) (Video, error) {
+	var video Video
+	counts := make([]int, len(Reactions))
+	dest := []interface{}{
+		&video.ID,
+		&video.CreatedAt,
+		&video.UpdatedAt,
+		&video.Version,
+		&video.Title,
+		&video.Description,
+		&video.ThumbnailURL,
+		&video.VideoURL,
+		&video.Duration,
+		&video.OriginalKey,
+		&video.AudioURL,
+		&video.AudioDuration,
+		&video.AspectRatio,
+		&video.ProcessingStatus,
+		&video.Visibility,
+		&video.PublishAt,
+		&video.DeletedAt,
+		&video.CommentsDisabled,
+		&video.UserID,
+	}
+	for i := range counts {
+		dest = append(dest, &counts[i])
+	}
+	err := row.Scan(dest...)
+	video.Reactions = map[string]int{}
+	for i, reaction := range Reactions {
+		video.Reactions[reaction] = counts[i]
+	}
+	return video, err
+}
+
+func (c Client) queryVideos(ctx context.Context, query string, args ...interface{}) ([]Video, error) {
+	rows, err := c.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -47,26 +129,161 @@ func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
 
 	videos := []Video{}
 	for rows.Next() {
-		var video Video
-		if err := rows.Scan(
-			&video.ID,
-			&video.CreatedAt,
-			&video.UpdatedAt,
-			&video.Title,
-			&video.Description,
-			&video.ThumbnailURL,
-			&video.VideoURL,
-			&video.UserID,
-		); err != nil {
+		video, err := scanVideo(rows)
+		if err != nil {
 			return nil, err
 		}
 		videos = append(videos, video)
 	}
 
-	return videos, nil
+	return videos, rows.Err()
 }
 
-func (c Client) CreateVideo(params CreateVideoParams) (Video, error) {
+// GetVideos returns one page of the videos matching the filters in params,
+// along with the total number of matches and a cursor for the next page
+// when there is one.
+func (c Client) GetVideos(ctx context.Context, params GetVideosParams) (VideoPage, error) {
+	params = params.withDefaults()
+	if err := params.Validate(); err != nil {
+		return VideoPage{}, err
+	}
+
+	where := []string{"deleted_at IS NULL"}
+	args := []interface{}{}
+	if params.UserID != uuid.Nil {
+		where = append(where, "user_id = ?")
+		args = append(args, params.UserID)
+	}
+	if params.Visibility != "" {
+		where = append(where, "visibility = ?")
+		args = append(args, params.Visibility)
+	}
+	if params.HasVideo != nil {
+		where = append(where, nullCheck("video_url", *params.HasVideo))
+	}
+	if params.HasThumbnail != nil {
+		where = append(where, nullCheck("thumbnail_url", *params.HasThumbnail))
+	}
+	if params.AspectRatio != "" {
+		where = append(where, "aspect_ratio = ?")
+		args = append(args, params.AspectRatio)
+	}
+	if params.ProcessingStatus != "" {
+		where = append(where, "processing_status = ?")
+		args = append(args, params.ProcessingStatus)
+	}
+	if params.CreatedAfter != nil {
+		where = append(where, "created_at >= ?")
+		args = append(args, c.db.dialect.timestamp(*params.CreatedAfter))
+	}
+	if params.CreatedBefore != nil {
+		where = append(where, "created_at < ?")
+		args = append(args, c.db.dialect.timestamp(*params.CreatedBefore))
+	}
+	if params.Tag != "" {
+		where = append(where, `id IN (
+		SELECT video_tags.video_id
+		FROM video_tags
+		JOIN tags ON tags.id = video_tags.tag_id
+		WHERE tags.name = ?
+	)`)
+		args = append(args, params.Tag)
+	}
+
+	var total int
+	countQuery := "SELECT COUNT(*) FROM videos WHERE " + strings.Join(where, " AND ")
+	err := c.db.QueryRowContext(ctx, countQuery, args...).Scan(&total)
+	if err != nil {
+		return VideoPage{}, err
+	}
+
+	column := string(params.Sort)
+	direction, comparison := "ASC", ">"
+	if params.Descending {
+		direction, comparison = "DESC", "<"
+	}
+
+	if params.Cursor != "" {
+		cursor, err := decodeVideoCursor(params.Cursor, params)
+		if err != nil {
+			return VideoPage{}, err
+		}
+		value, err := c.cursorValue(params.Sort, cursor.Value)
+		if err != nil {
+			return VideoPage{}, err
+		}
+		where = append(where, fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", column, comparison))
+		args = append(args, value, value, cursor.ID)
+	}
+
+	query := fmt.Sprintf(`
+	SELECT %s
+	FROM videos
+	WHERE %s
+	ORDER BY %s %s, id %s
+	LIMIT ?
+	`, videoColumns, strings.Join(where, " AND "), column, direction, direction)
+	// Fetch one extra row to find out whether there is a next page
+	args = append(args, params.Limit+1)
+
+	videos, err := c.queryVideos(ctx, query, args...)
+	if err != nil {
+		return VideoPage{}, err
+	}
+	err = c.loadVideoTags(ctx, videos)
+	if err != nil {
+		return VideoPage{}, err
+	}
+
+	page := VideoPage{
+		Videos: videos,
+		Total:  total,
+	}
+	if len(videos) > params.Limit {
+		page.Videos = videos[:params.Limit]
+		page.NextCursor = encodeVideoCursor(page.Videos[params.Limit-1], params)
+	}
+	return page, nil
+}
+
+// cursorValue converts a cursor's sort value back into a query argument.
+func (c Client) cursorValue(sort VideoSort, value string) (interface{}, error) {
+	if sort == VideoSortTitle {
+		return value, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return c.db.dialect.timestamp(t), nil
+}
+
+func nullCheck(column string, present bool) string {
+	if present {
+		return column + " IS NOT NULL"
+	}
+	return column + " IS NULL"
+}
+
+// GetVideosWithOriginals returns every video that has an archived original
+// upload to re-process from.
+func (c Client) GetVideosWithOriginals(ctx context.Context) ([]Video, error) {
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	WHERE original_key IS NOT NULL AND deleted_at IS NULL
+	ORDER BY created_at
+	`
+	return c.queryVideos(ctx, query)
+}
+
+func (c Client) CreateVideo(ctx context.Context, params CreateVideoParams) (Video, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Video{}, err
+	}
+	defer tx.Rollback()
+
 	id := uuid.New()
 	query := `
 	INSERT INTO videos (
@@ -75,81 +292,295 @@ func (c Client) CreateVideo(params CreateVideoParams) (Video, error) {
 		updated_at,
 		title,
 		description,
+		processing_status,
+		visibility,
+		publish_at,
 		user_id
-	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?)
+	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?, ?)
 	`
-	_, err := c.db.Exec(query, id, params.Title, params.Description, params.UserID)
+	if params.Visibility == "" {
+		params.Visibility = VisibilityPrivate
+	}
+	_, err = tx.ExecContext(ctx, query,
+		id,
+		params.Title,
+		params.Description,
+		ProcessingStatusPending,
+		params.Visibility,
+		c.db.dialect.nullTimestamp(params.PublishAt),
+		params.UserID,
+	)
+	if err != nil {
+		return Video{}, err
+	}
+
+	err = setVideoTags(ctx, tx, id, params.UserID, params.Tags)
 	if err != nil {
 		return Video{}, err
 	}
 
-	return c.GetVideo(id)
+	if err := tx.Commit(); err != nil {
+		return Video{}, err
+	}
+
+	return c.GetVideo(ctx, id)
 }
 
-func (c Client) GetVideo(id uuid.UUID) (Video, error) {
+func (c Client) GetVideo(ctx context.Context, id uuid.UUID) (Video, error) {
 	query := `
-	SELECT
-		id,
-		created_at,
-		updated_at,
-		title,
-		description,
-		thumbnail_url,
-		video_url,
-		user_id
+	SELECT` + videoColumns + `
 	FROM videos
-	WHERE id = ?
+	WHERE id = ? AND deleted_at IS NULL
 	`
 
-	var video Video
-	err := c.db.QueryRow(query, id).Scan(
-		&video.ID,
-		&video.CreatedAt,
-		&video.UpdatedAt,
-		&video.Title,
-		&video.Description,
-		&video.ThumbnailURL,
-		&video.VideoURL,
-		&video.UserID)
+	video, err := scanVideo(c.db.QueryRowContext(ctx, query, id))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return Video{}, nil
+			return Video{}, ErrNotFound
 		}
 		return Video{}, err
 	}
 
+	video.Tags, err = c.getVideoTags(ctx, id)
+	if err != nil {
+		return Video{}, err
+	}
+
 	return video, nil
 }
 
-func (c Client) UpdateVideo(video Video) error {
+func (c Client) UpdateVideo(ctx context.Context, video Video) error {
+	return c.updateVideo(ctx, c.db, video)
+}
+
+// execer is satisfied by both conn and tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// querier is an execer that can also read, satisfied by both conn and tx.
+type querier interface {
+	execer
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func (c Client) updateVideo(ctx context.Context, db execer, video Video) error {
 	query := `
 	UPDATE videos
 	SET
+		updated_at = CURRENT_TIMESTAMP,
+		version = version + 1,
 		title = ?,
 		description = ?,
 		thumbnail_url = ?,
 		video_url = ?,
+		duration = ?,
+		original_key = ?,
+		audio_url = ?,
+		audio_duration = ?,
+		aspect_ratio = ?,
+		processing_status = ?,
+		visibility = ?,
+		publish_at = ?,
+		comments_disabled = ?,
 		user_id = ?
 	WHERE id = ?
 	`
 
-	_, err := c.db.Exec(
+	return requireRowsAffected(db.ExecContext(ctx,
 		query,
 		video.Title,
 		video.Description,
 		&video.ThumbnailURL,
 		&video.VideoURL,
+		video.Duration,
+		video.OriginalKey,
+		video.AudioURL,
+		video.AudioDuration,
+		video.AspectRatio,
+		video.ProcessingStatus,
+		video.Visibility,
+		c.db.dialect.nullTimestamp(video.PublishAt),
+		video.CommentsDisabled,
 		video.UserID,
 		video.ID,
-	)
-	return err
+	))
+}
+
+// UpdateVideoMetadataParams lists the fields changed by
+// UpdateVideoMetadata. Nil fields are left as they are.
+type UpdateVideoMetadataParams struct {
+	Title       *string
+	Description *string
+	// UserID is recorded as the author of the revision.
+	UserID uuid.UUID
+	// IfVersion makes the update fail with ErrModified unless the video is
+	// still at this version.
+	IfVersion *int
+}
+
+// UpdateVideoMetadata changes a video's title and description without
+// touching the rest of the row, and records a metadata revision.
+func (c Client) UpdateVideoMetadata(ctx context.Context, id uuid.UUID, params UpdateVideoMetadataParams) (Video, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Video{}, err
+	}
+	defer tx.Rollback()
+
+	before, err := getVideoForUpdate(ctx, tx, id)
+	if err != nil {
+		return Video{}, err
+	}
+	if params.IfVersion != nil && *params.IfVersion != before.Version {
+		return Video{}, ErrModified
+	}
+
+	query := "UPDATE videos SET updated_at = CURRENT_TIMESTAMP, version = version + 1"
+	args := []interface{}{}
+	after := before
+	if params.Title != nil {
+		query += ", title = ?"
+		args = append(args, *params.Title)
+		after.Title = *params.Title
+	}
+	if params.Description != nil {
+		query += ", description = ?"
+		args = append(args, *params.Description)
+		after.Description = *params.Description
+	}
+	// Matching the version again catches a concurrent edit between the read
+	// above and this write.
+	query += " WHERE id = ? AND version = ?"
+	args = append(args, id, before.Version)
+	result, err := tx.ExecContext(ctx, query, args...)
+	err = requireRowsAffected(result, err)
+	if errors.Is(err, ErrNotFound) {
+		return Video{}, ErrModified
+	}
+	if err != nil {
+		return Video{}, err
+	}
+
+	err = c.createRevisions(ctx, tx, before, after, params.UserID, nil)
+	if err != nil {
+		return Video{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Video{}, err
+	}
+	return c.GetVideo(ctx, id)
+}
+
+// UpdateVideoVisibilityParams sets who can see a video and when it is
+// published.
+type UpdateVideoVisibilityParams struct {
+	Visibility string
+	// PublishAt schedules the video to be made public, nil clears the
+	// schedule.
+	PublishAt *time.Time
+	// UserID is recorded as the author of the revision.
+	UserID uuid.UUID
+	// IfVersion makes the update fail with ErrModified unless the video is
+	// still at this version.
+	IfVersion *int
+}
+
+// UpdateVideoVisibility changes a video's visibility and schedule without
+// touching the rest of the row, and records a visibility revision.
+func (c Client) UpdateVideoVisibility(ctx context.Context, id uuid.UUID, params UpdateVideoVisibilityParams) (Video, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Video{}, err
+	}
+	defer tx.Rollback()
+
+	before, err := getVideoForUpdate(ctx, tx, id)
+	if err != nil {
+		return Video{}, err
+	}
+	if params.IfVersion != nil && *params.IfVersion != before.Version {
+		return Video{}, ErrModified
+	}
+
+	query := `
+	UPDATE videos
+	SET updated_at = CURRENT_TIMESTAMP, version = version + 1, visibility = ?, publish_at = ?
+	WHERE id = ? AND version = ?
+	`
+	result, err := tx.ExecContext(ctx, query, params.Visibility, c.db.dialect.nullTimestamp(params.PublishAt), id, before.Version)
+	err = requireRowsAffected(result, err)
+	if errors.Is(err, ErrNotFound) {
+		return Video{}, ErrModified
+	}
+	if err != nil {
+		return Video{}, err
+	}
+
+	after := before
+	after.Visibility = params.Visibility
+	after.PublishAt = params.PublishAt
+	err = c.createRevisions(ctx, tx, before, after, params.UserID, nil)
+	if err != nil {
+		return Video{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Video{}, err
+	}
+	return c.GetVideo(ctx, id)
 }
 
-func (c Client) DeleteVideo(id uuid.UUID) error {
+// SetVideoProcessingStatus updates only the processing status, so it can be
+// called while other fields of the video are being changed elsewhere.
+func (c Client) SetVideoProcessingStatus(ctx context.Context, id uuid.UUID, status string) error {
+	query := `
+	UPDATE videos
+	SET processing_status = ?, version = version + 1
+	WHERE id = ?
+	`
+	return requireRowsAffected(c.db.ExecContext(ctx, query, status, id))
+}
+
+func (c Client) DeleteVideo(ctx context.Context, id uuid.UUID) error {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var userID uuid.UUID
+	err = tx.QueryRowContext(ctx, "SELECT user_id FROM videos WHERE id = ?", id).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, table := range []string{"video_captions", "video_chapters", "video_fingerprints", "video_revisions", "video_tags", "playback_sessions", "video_daily_stats", "comments", "video_reactions"} {
+		_, err = tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE video_id = ?", id)
+		if err != nil {
+			return err
+		}
+	}
+	err = deleteUnusedTags(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+	err = removeVideoFromPlaylists(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
 	query := `
 	DELETE FROM videos
 	WHERE id = ?
 	`
-	_, err := c.db.Exec(query, id)
-	return err
+	err = requireRowsAffected(tx.ExecContext(ctx, query, id))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
 }
@@ -0,0 +1,194 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const WebhookEventVideoPublished = "video.published"
+
+// WebhookDelivery is a queued webhook call. NextAttemptAt is nil once the
+// call succeeded or was given up on.
+type WebhookDelivery struct {
+	ID            uuid.UUID  `json:"id"`
+	CreatedAt     time.Time  `json:"created_at"`
+	Event         string     `json:"event"`
+	URL           string     `json:"url"`
+	Payload       string     `json:"payload"`
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt *time.Time `json:"next_attempt_at"`
+	DeliveredAt   *time.Time `json:"delivered_at"`
+	LastError     *string    `json:"last_error"`
+}
+
+// WebhookPayload is the JSON body sent for video events.
+type WebhookPayload struct {
+	Event string `json:"event"`
+	Video Video  `json:"video"`
+}
+
+// PublishDueVideos makes every private video whose publish_at has passed
+// public and queues a video.published delivery to each webhook URL. Both
+// happen in one transaction, so a restart can neither publish a video
+// without queueing its webhooks nor queue them twice.
+func (c Client) PublishDueVideos(ctx context.Context, now time.Time, webhookURLs []string) ([]Video, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	WHERE publish_at IS NOT NULL AND publish_at <= ? AND deleted_at IS NULL
+	ORDER BY publish_at
+	`
+	rows, err := tx.QueryContext(ctx, query, c.db.dialect.timestamp(now))
+	if err != nil {
+		return nil, err
+	}
+	videos := []Video{}
+	for rows.Next() {
+		video, err := scanVideo(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		videos = append(videos, video)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	published := []Video{}
+	for _, video := range videos {
+		// Another publisher, or an owner rescheduling the video, may have
+		// got there first, in which case there's nothing to announce
+		query := `
+		UPDATE videos
+		SET updated_at = CURRENT_TIMESTAMP, version = version + 1, visibility = ?, publish_at = NULL
+		WHERE id = ? AND publish_at IS NOT NULL AND publish_at <= ? AND deleted_at IS NULL
+		`
+		result, err := tx.ExecContext(ctx, query, VisibilityPublic, video.ID, c.db.dialect.timestamp(now))
+		err = requireRowsAffected(result, err)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		video.Visibility = VisibilityPublic
+		video.PublishAt = nil
+		video.Version++
+		published = append(published, video)
+
+		payload, err := json.Marshal(WebhookPayload{
+			Event: WebhookEventVideoPublished,
+			Video: video,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, url := range webhookURLs {
+			query := `
+			INSERT INTO webhook_deliveries (
+				id,
+				created_at,
+				event,
+				url,
+				payload,
+				next_attempt_at
+			) VALUES (?, CURRENT_TIMESTAMP, ?, ?, ?, ?)
+			`
+			_, err = tx.ExecContext(ctx, query, uuid.New(), WebhookEventVideoPublished, url, string(payload), c.db.dialect.timestamp(now))
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return published, nil
+}
+
+// GetDueWebhookDeliveries returns up to limit deliveries waiting to be
+// attempted, oldest first.
+func (c Client) GetDueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]WebhookDelivery, error) {
+	query := `
+	SELECT
+		id,
+		created_at,
+		event,
+		url,
+		payload,
+		attempts,
+		next_attempt_at,
+		delivered_at,
+		last_error
+	FROM webhook_deliveries
+	WHERE next_attempt_at IS NOT NULL AND next_attempt_at <= ?
+	ORDER BY next_attempt_at
+	LIMIT ?
+	`
+	rows, err := c.db.QueryContext(ctx, query, c.db.dialect.timestamp(now), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		var d WebhookDelivery
+		err := rows.Scan(
+			&d.ID,
+			&d.CreatedAt,
+			&d.Event,
+			&d.URL,
+			&d.Payload,
+			&d.Attempts,
+			&d.NextAttemptAt,
+			&d.DeliveredAt,
+			&d.LastError,
+		)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+func (c Client) MarkWebhookDelivered(ctx context.Context, id uuid.UUID) error {
+	query := `
+	UPDATE webhook_deliveries
+	SET
+		attempts = attempts + 1,
+		next_attempt_at = NULL,
+		delivered_at = CURRENT_TIMESTAMP,
+		last_error = NULL
+	WHERE id = ?
+	`
+	return requireRowsAffected(c.db.ExecContext(ctx, query, id))
+}
+
+// MarkWebhookFailed records a failed attempt. A nil nextAttemptAt gives up
+// on the delivery.
+func (c Client) MarkWebhookFailed(ctx context.Context, id uuid.UUID, lastError string, nextAttemptAt *time.Time) error {
+	query := `
+	UPDATE webhook_deliveries
+	SET
+		attempts = attempts + 1,
+		next_attempt_at = ?,
+		last_error = ?
+	WHERE id = ?
+	`
+	return requireRowsAffected(c.db.ExecContext(ctx, query, c.db.dialect.nullTimestamp(nextAttemptAt), lastError, id))
+}
@@ -4,18 +4,21 @@ import (
 	"context"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
 
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/joho/godotenv"
-	_ "github.com/lib/pq"
 )
 
 type apiConfig struct {
-	db               database.Client
+	db               database.Store
 	jwtSecret        string
 	platform         string
 	filepathRoot     string
@@ -25,14 +28,35 @@ type apiConfig struct {
 	s3CfDistribution string
 	s3Client         *s3.Client
 	port             string
+	duplicatePolicy  string
+	duplicateScope   string
+	// Optional S3 storage class for archived original uploads
+	originalsStorageClass string
+	adminAPIKey           string
+	audioFormat           string
+	// Endpoints notified when scheduled videos are published
+	webhookURLs   []string
+	webhookSecret string
+	// How long deleted videos can be restored before they are purged
+	trashRetention time.Duration
+	// Lifetimes of access JWTs and of refresh tokens
+	accessTokenTTL  time.Duration
+	refreshTokenTTL time.Duration
+	// Caps playback events for each client address, since anyone can
+	// report them
+	playbackEventLimiter *rateLimiter
 }
 
 func main() {
 	godotenv.Load(".env")
 
-	pathToDB := os.Getenv("DB_PATH")
+	// DB_URL takes a postgres:// URL, DB_PATH a SQLite file
+	pathToDB := os.Getenv("DB_URL")
 	if pathToDB == "" {
-		log.Fatal("DB_URL must be set")
+		pathToDB = os.Getenv("DB_PATH")
+	}
+	if pathToDB == "" {
+		log.Fatal("DB_URL or DB_PATH must be set")
 	}
 
 	db, err := database.NewClient(pathToDB)
@@ -80,6 +104,74 @@ func main() {
 		log.Fatal("PORT environment variable is not set")
 	}
 
+	duplicatePolicy := os.Getenv("DUPLICATE_POLICY")
+	if duplicatePolicy == "" {
+		duplicatePolicy = duplicatePolicyWarn
+	}
+	if duplicatePolicy != duplicatePolicyOff && duplicatePolicy != duplicatePolicyWarn && duplicatePolicy != duplicatePolicyBlock {
+		log.Fatal("DUPLICATE_POLICY must be one of off, warn or block")
+	}
+
+	duplicateScope := os.Getenv("DUPLICATE_SCOPE")
+	if duplicateScope == "" {
+		duplicateScope = duplicateScopeUser
+	}
+	if duplicateScope != duplicateScopeUser && duplicateScope != duplicateScopeGlobal {
+		log.Fatal("DUPLICATE_SCOPE must be one of user or global")
+	}
+
+	originalsStorageClass := os.Getenv("ORIGINALS_STORAGE_CLASS")
+	if !isInstantStorageClass(originalsStorageClass) {
+		log.Fatal("ORIGINALS_STORAGE_CLASS must be a storage class that can be read without a restore")
+	}
+
+	adminAPIKey := os.Getenv("ADMIN_API_KEY")
+
+	audioFormat := os.Getenv("AUDIO_FORMAT")
+	if audioFormat == "" {
+		audioFormat = "aac"
+	}
+	if _, ok := audioFormats[audioFormat]; !ok {
+		log.Fatal("AUDIO_FORMAT must be one of aac or mp3")
+	}
+
+	webhookURLs := []string{}
+	for _, webhookURL := range strings.Split(os.Getenv("WEBHOOK_URLS"), ",") {
+		webhookURL = strings.TrimSpace(webhookURL)
+		if webhookURL == "" {
+			continue
+		}
+		u, err := url.Parse(webhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			log.Fatalf("WEBHOOK_URLS contains an invalid URL: %q", webhookURL)
+		}
+		webhookURLs = append(webhookURLs, webhookURL)
+	}
+
+	trashRetentionDays := 30
+	if v := os.Getenv("TRASH_RETENTION_DAYS"); v != "" {
+		trashRetentionDays, err = strconv.Atoi(v)
+		if err != nil || trashRetentionDays < 1 {
+			log.Fatal("TRASH_RETENTION_DAYS must be a positive number of days")
+		}
+	}
+
+	accessTokenMinutes := 15
+	if v := os.Getenv("ACCESS_TOKEN_MINUTES"); v != "" {
+		accessTokenMinutes, err = strconv.Atoi(v)
+		if err != nil || accessTokenMinutes < 1 {
+			log.Fatal("ACCESS_TOKEN_MINUTES must be a positive number of minutes")
+		}
+	}
+
+	refreshTokenDays := 60
+	if v := os.Getenv("REFRESH_TOKEN_DAYS"); v != "" {
+		refreshTokenDays, err = strconv.Atoi(v)
+		if err != nil || refreshTokenDays < 1 {
+			log.Fatal("REFRESH_TOKEN_DAYS must be a positive number of days")
+		}
+	}
+
 	awsCfg, err := config.LoadDefaultConfig(
 		context.Background(),
 		config.WithRegion(s3Region),
@@ -101,6 +193,31 @@ func main() {
 		s3CfDistribution: s3CfDistribution,
 		s3Client:         s3Client,
 		port:             port,
+		duplicatePolicy:  duplicatePolicy,
+		duplicateScope:   duplicateScope,
+
+		originalsStorageClass: originalsStorageClass,
+		adminAPIKey:           adminAPIKey,
+		audioFormat:           audioFormat,
+		webhookURLs:           webhookURLs,
+		webhookSecret:         os.Getenv("WEBHOOK_SECRET"),
+		trashRetention:        time.Duration(trashRetentionDays) * 24 * time.Hour,
+		accessTokenTTL:        time.Duration(accessTokenMinutes) * time.Minute,
+		refreshTokenTTL:       time.Duration(refreshTokenDays) * 24 * time.Hour,
+		playbackEventLimiter:  newRateLimiter(time.Minute, maxPlaybackEventsPerMinute),
+	}
+
+	if len(os.Args) > 1 {
+		err := cfg.runCommand(context.Background(), db, os.Args[1:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	err = migrateUp(db)
+	if err != nil {
+		log.Fatalf("Couldn't migrate database: %v", err)
 	}
 
 	err = cfg.ensureAssetsDir()
@@ -108,34 +225,90 @@ func main() {
 		log.Fatalf("Couldn't create assets directory: %v", err)
 	}
 
+	go cfg.runPublishScheduler(context.Background())
+	go cfg.runTrashPurger(context.Background())
+
+	srv := &http.Server{
+		Addr:    ":" + port,
+		Handler: cfg.routes(),
+	}
+
+	log.Printf("Serving on: http://localhost:%s/app/\n", port)
+	log.Fatal(srv.ListenAndServe())
+}
+
+// routes registers every endpoint of the API.
+func (cfg *apiConfig) routes() *http.ServeMux {
 	mux := http.NewServeMux()
-	appHandler := http.StripPrefix("/app", http.FileServer(http.Dir(filepathRoot)))
+	appHandler := http.StripPrefix("/app", http.FileServer(http.Dir(cfg.filepathRoot)))
 	mux.Handle("/app/", appHandler)
 
-	assetsHandler := http.StripPrefix("/assets", http.FileServer(http.Dir(assetsRoot)))
+	assetsHandler := http.StripPrefix("/assets", http.FileServer(http.Dir(cfg.assetsRoot)))
 	mux.Handle("/assets/", noCacheMiddleware(assetsHandler))
 
 	mux.HandleFunc("POST /api/login", cfg.handlerLogin)
 	mux.HandleFunc("POST /api/refresh", cfg.handlerRefresh)
 	mux.HandleFunc("POST /api/revoke", cfg.handlerRevoke)
+	mux.HandleFunc("GET /api/sessions", cfg.handlerSessionsRetrieve)
+	mux.HandleFunc("DELETE /api/sessions", cfg.handlerSessionsDelete)
+	mux.HandleFunc("DELETE /api/sessions/{sessionID}", cfg.handlerSessionDelete)
 
 	mux.HandleFunc("POST /api/users", cfg.handlerUsersCreate)
+	mux.HandleFunc("PUT /api/users/password", cfg.handlerUserPasswordUpdate)
 
 	mux.HandleFunc("POST /api/videos", cfg.handlerVideoMetaCreate)
 	mux.HandleFunc("POST /api/thumbnail_upload/{videoID}", cfg.handlerUploadThumbnail)
 	mux.HandleFunc("POST /api/video_upload/{videoID}", cfg.handlerUploadVideo)
 	mux.HandleFunc("GET /api/videos", cfg.handlerVideosRetrieve)
+	mux.HandleFunc("GET /api/videos/search", cfg.handlerVideosSearch)
+	mux.HandleFunc("GET /api/videos/trash", cfg.handlerTrashRetrieve)
 	mux.HandleFunc("GET /api/videos/{videoID}", cfg.handlerVideoGet)
+	mux.HandleFunc("PATCH /api/videos/{videoID}", cfg.handlerVideoMetaUpdate)
+	mux.HandleFunc("PUT /api/videos/{videoID}/visibility", cfg.handlerVideoVisibilityUpdate)
+	mux.HandleFunc("PUT /api/videos/{videoID}/schedule", cfg.handlerVideoScheduleUpdate)
+	mux.HandleFunc("GET /api/public/videos", cfg.handlerPublicVideosRetrieve)
+
+	mux.HandleFunc("POST /api/videos/{videoID}/captions", cfg.handlerCaptionUpload)
+	mux.HandleFunc("GET /api/videos/{videoID}/captions", cfg.handlerCaptionsRetrieve)
+	mux.HandleFunc("DELETE /api/videos/{videoID}/captions/{language}", cfg.handlerCaptionDelete)
+
+	mux.HandleFunc("PUT /api/videos/{videoID}/tags", cfg.handlerVideoTagsUpdate)
+	mux.HandleFunc("GET /api/tags", cfg.handlerTagsRetrieve)
+
+	mux.HandleFunc("PUT /api/videos/{videoID}/chapters", cfg.handlerChaptersUpdate)
+	mux.HandleFunc("GET /api/videos/{videoID}/chapters", cfg.handlerChaptersRetrieve)
+	mux.HandleFunc("GET /api/videos/{videoID}/chapters.vtt", cfg.handlerChaptersVTT)
 
 	mux.HandleFunc("DELETE /api/videos/{videoID}", cfg.handlerVideoMetaDelete)
+	mux.HandleFunc("POST /api/videos/{videoID}/restore", cfg.handlerVideoRestore)
+	mux.HandleFunc("GET /api/videos/{videoID}/revisions", cfg.handlerVideoRevisionsRetrieve)
+	mux.HandleFunc("POST /api/videos/{videoID}/events", cfg.handlerPlaybackEventCreate)
+	mux.HandleFunc("GET /api/videos/{videoID}/analytics", cfg.handlerVideoAnalyticsRetrieve)
+	mux.HandleFunc("PUT /api/videos/{videoID}/reaction", cfg.handlerVideoReactionUpdate)
+	mux.HandleFunc("DELETE /api/videos/{videoID}/reaction", cfg.handlerVideoReactionDelete)
+	mux.HandleFunc("GET /api/videos/{videoID}/comments", cfg.handlerCommentsRetrieve)
+	mux.HandleFunc("POST /api/videos/{videoID}/comments", cfg.handlerCommentCreate)
+	mux.HandleFunc("PATCH /api/videos/{videoID}/comments/{commentID}", cfg.handlerCommentUpdate)
+	mux.HandleFunc("DELETE /api/videos/{videoID}/comments/{commentID}", cfg.handlerCommentDelete)
+	mux.HandleFunc("GET /api/videos/{videoID}/comments/{commentID}/replies", cfg.handlerCommentRepliesRetrieve)
+	mux.HandleFunc("PUT /api/videos/{videoID}/comments/{commentID}/pin", cfg.handlerCommentPin)
+	mux.HandleFunc("PUT /api/videos/{videoID}/comment_settings", cfg.handlerCommentSettingsUpdate)
+	mux.HandleFunc("POST /api/videos/{videoID}/revisions/{revisionID}/rollback", cfg.handlerVideoRevisionRollback)
 
-	mux.HandleFunc("POST /admin/reset", cfg.handlerReset)
+	mux.HandleFunc("POST /api/playlists", cfg.handlerPlaylistCreate)
+	mux.HandleFunc("GET /api/playlists", cfg.handlerPlaylistsRetrieve)
+	mux.HandleFunc("GET /api/playlists/{playlistID}", cfg.handlerPlaylistGet)
+	mux.HandleFunc("PUT /api/playlists/{playlistID}", cfg.handlerPlaylistUpdate)
+	mux.HandleFunc("DELETE /api/playlists/{playlistID}", cfg.handlerPlaylistDelete)
+	mux.HandleFunc("POST /api/playlists/{playlistID}/thumbnail", cfg.handlerPlaylistThumbnailUpload)
+	mux.HandleFunc("POST /api/playlists/{playlistID}/items", cfg.handlerPlaylistItemAdd)
+	mux.HandleFunc("PUT /api/playlists/{playlistID}/items", cfg.handlerPlaylistItemsReorder)
+	mux.HandleFunc("PATCH /api/playlists/{playlistID}/items/{itemID}", cfg.handlerPlaylistItemMove)
+	mux.HandleFunc("DELETE /api/playlists/{playlistID}/items/{itemID}", cfg.handlerPlaylistItemDelete)
 
-	srv := &http.Server{
-		Addr:    ":" + port,
-		Handler: mux,
-	}
+	mux.HandleFunc("POST /admin/reset", cfg.handlerReset)
+	mux.HandleFunc("POST /admin/videos/reprocess", cfg.handlerReprocessAll)
+	mux.HandleFunc("POST /admin/videos/{videoID}/reprocess", cfg.handlerReprocessVideo)
 
-	log.Printf("Serving on: http://localhost:%s/app/\n", port)
-	log.Fatal(srv.ListenAndServe())
+	return mux
 }
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiter allows each key a number of requests per fixed window. All
+// counts are dropped when the window rolls over, so memory stays bounded
+// by the clients seen in one window.
+type rateLimiter struct {
+	mu          sync.Mutex
+	window      time.Duration
+	limit       int
+	windowStart time.Time
+	counts      map[string]int
+}
+
+func newRateLimiter(window time.Duration, limit int) *rateLimiter {
+	return &rateLimiter{
+		window: window,
+		limit:  limit,
+		counts: map[string]int{},
+	}
+}
+
+// allow counts a request by key and reports whether it is within the
+// limit, and if not, how long until the window resets.
+func (l *rateLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.windowStart) >= l.window {
+		l.windowStart = now
+		clear(l.counts)
+	}
+	if l.counts[key] >= l.limit {
+		return false, l.windowStart.Add(l.window).Sub(now)
+	}
+	l.counts[key]++
+	return true, 0
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+const (
+	publishSchedulerInterval = 30 * time.Second
+	webhookBatchSize         = 50
+	webhookTimeout           = 10 * time.Second
+	maxWebhookAttempts       = 8
+)
+
+// runPublishScheduler publishes scheduled videos and delivers queued webhooks
+// until ctx is cancelled. Everything it works from is in the database, so
+// videos that came due while the server was down are published on the
+// first tick.
+func (cfg *apiConfig) runPublishScheduler(ctx context.Context) {
+	ticker := time.NewTicker(publishSchedulerInterval)
+	defer ticker.Stop()
+
+	for {
+		videos, err := cfg.db.PublishDueVideos(ctx, time.Now(), cfg.webhookURLs)
+		if err != nil {
+			log.Printf("Couldn't publish scheduled videos: %v", err)
+		}
+		for _, video := range videos {
+			log.Printf("Published scheduled video %s", video.ID)
+		}
+
+		err = cfg.deliverWebhooks(ctx)
+		if err != nil {
+			log.Printf("Couldn't deliver webhooks: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliverWebhooks attempts every due delivery once, backing off
+// exponentially after failures and giving up after maxWebhookAttempts.
+func (cfg *apiConfig) deliverWebhooks(ctx context.Context) error {
+	deliveries, err := cfg.db.GetDueWebhookDeliveries(ctx, time.Now(), webhookBatchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, delivery := range deliveries {
+		err := cfg.sendWebhook(ctx, delivery)
+		if err == nil {
+			err = cfg.db.MarkWebhookDelivered(ctx, delivery.ID)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		log.Printf("Webhook delivery %s to %s failed: %v", delivery.ID, delivery.URL, err)
+		var nextAttemptAt *time.Time
+		if delivery.Attempts+1 < maxWebhookAttempts {
+			next := time.Now().Add(time.Minute << delivery.Attempts)
+			nextAttemptAt = &next
+		}
+		err = cfg.db.MarkWebhookFailed(ctx, delivery.ID, err.Error(), nextAttemptAt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendWebhook posts the delivery's payload. When WEBHOOK_SECRET is set the
+// body is signed with HMAC-SHA256 so receivers can verify it came from us.
+func (cfg *apiConfig) sendWebhook(ctx context.Context, delivery database.WebhookDelivery) error {
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewBufferString(delivery.Payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Tubely-Event", delivery.Event)
+	req.Header.Set("X-Tubely-Delivery", delivery.ID.String())
+	if cfg.webhookSecret != "" {
+		mac := hmac.New(sha256.New, []byte(cfg.webhookSecret))
+		mac.Write([]byte(delivery.Payload))
+		req.Header.Set("X-Tubely-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
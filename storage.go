@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// putObject uploads body to the S3 bucket under key and returns the
+// CloudFront URL it will be served from.
+func (cfg *apiConfig) putObject(ctx context.Context, key, contentType string, body io.Reader, opts ...func(*s3.PutObjectInput)) (string, error) {
+	input := &s3.PutObjectInput{
+		Bucket:      &cfg.s3Bucket,
+		Key:         &key,
+		Body:        body,
+		ContentType: &contentType,
+	}
+	for _, opt := range opts {
+		opt(input)
+	}
+
+	_, err := cfg.s3Client.PutObject(ctx, input)
+	if err != nil {
+		return "", err
+	}
+	return cfg.getObjectURL(key), nil
+}
+
+// getObject downloads the object stored under key into w.
+func (cfg *apiConfig) getObject(ctx context.Context, key string, w io.Writer) error {
+	out, err := cfg.s3Client.GetObject(
+		ctx,
+		&s3.GetObjectInput{
+			Bucket: &cfg.s3Bucket,
+			Key:    &key,
+		},
+	)
+	if err != nil {
+		return err
+	}
+	defer out.Body.Close()
+
+	_, err = io.Copy(w, out.Body)
+	return err
+}
+
+// deleteObject removes the object stored under key. Deleting a key that
+// doesn't exist is not an error.
+func (cfg *apiConfig) deleteObject(ctx context.Context, key string) error {
+	_, err := cfg.s3Client.DeleteObject(
+		ctx,
+		&s3.DeleteObjectInput{
+			Bucket: &cfg.s3Bucket,
+			Key:    &key,
+		},
+	)
+	return err
+}
+
+// objectKey returns the key of an object from the URL getObjectURL built
+// for it, and false for URLs that don't point at our distribution.
+func (cfg *apiConfig) objectKey(objectURL string) (string, bool) {
+	return strings.CutPrefix(objectURL, cfg.s3CfDistribution+"/")
+}
+
+func (cfg *apiConfig) getObjectURL(key string) string {
+	return fmt.Sprintf(
+		"%s/%s",
+		cfg.s3CfDistribution,
+		key,
+	)
+}
+
+// randomObjectName returns a random URL-safe name for a new object.
+func randomObjectName() (string, error) {
+	rndm := make([]byte, 32)
+	_, err := rand.Read(rndm)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(rndm), nil
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/google/uuid"
+)
+
+var errStaleAccessToken = errors.New("access token was issued before the user's password changed")
+
+// validateJWT checks an access token and that it was issued for the user's
+// current token version, returning the user's ID.
+func (cfg *apiConfig) validateJWT(ctx context.Context, token string) (uuid.UUID, error) {
+	claims, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	user, err := cfg.db.GetUser(ctx, claims.UserID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if user.TokenVersion != claims.TokenVersion {
+		return uuid.Nil, errStaleAccessToken
+	}
+	return user.ID, nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+const trashPurgeInterval = time.Hour
+
+// runTrashPurger permanently deletes videos that have been in the trash for
+// longer than the retention window, until ctx is cancelled.
+func (cfg *apiConfig) runTrashPurger(ctx context.Context) {
+	ticker := time.NewTicker(trashPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := cfg.purgeTrash(ctx)
+		if err != nil {
+			log.Printf("Couldn't purge trash: %v", err)
+		}
+		if purged > 0 {
+			log.Printf("Purged %d videos from the trash", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purgeTrash deletes expired videos and their media. A video whose media
+// can't be removed is kept so the next run tries again.
+func (cfg *apiConfig) purgeTrash(ctx context.Context) (int, error) {
+	videos, err := cfg.db.GetVideosTrashedBefore(ctx, time.Now().Add(-cfg.trashRetention))
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, video := range videos {
+		err := cfg.deleteVideoMedia(ctx, video)
+		if err != nil {
+			log.Printf("Couldn't delete media of video %s: %v", video.ID, err)
+			continue
+		}
+		err = cfg.db.DeleteVideo(ctx, video.ID)
+		if err != nil && !errors.Is(err, database.ErrNotFound) {
+			log.Printf("Couldn't delete video %s: %v", video.ID, err)
+			continue
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// deleteVideoMedia removes everything stored for a video, including earlier
+// revisions: processed videos, archived originals, audio renditions and
+// captions in S3, and thumbnails on disk.
+func (cfg *apiConfig) deleteVideoMedia(ctx context.Context, video database.Video) error {
+	videoURLs := []*string{video.VideoURL, video.AudioURL}
+	originalKeys := []*string{video.OriginalKey}
+	thumbnailURLs := []*string{video.ThumbnailURL}
+
+	revisions, err := cfg.db.GetVideoRevisions(ctx, video.ID)
+	if err != nil {
+		return err
+	}
+	for _, revision := range revisions {
+		for field, change := range revision.Changes {
+			switch field {
+			case "video_url", "audio_url":
+				videoURLs = append(videoURLs, change.Old, change.New)
+			case "original_key":
+				originalKeys = append(originalKeys, change.Old, change.New)
+			case "thumbnail_url":
+				thumbnailURLs = append(thumbnailURLs, change.Old, change.New)
+			}
+		}
+	}
+
+	keys := map[string]bool{}
+	for _, objectURL := range videoURLs {
+		if objectURL == nil {
+			continue
+		}
+		if key, ok := cfg.objectKey(*objectURL); ok {
+			keys[key] = true
+		}
+	}
+	for _, key := range originalKeys {
+		if key != nil {
+			keys[*key] = true
+		}
+	}
+
+	captions, err := cfg.db.GetCaptions(ctx, video.ID)
+	if err != nil {
+		return err
+	}
+	for _, caption := range captions {
+		if key, ok := cfg.objectKey(caption.URL); ok {
+			keys[key] = true
+		}
+	}
+
+	for key := range keys {
+		err := cfg.deleteObject(ctx, key)
+		if err != nil {
+			return fmt.Errorf("delete %s: %w", key, err)
+		}
+	}
+
+	for _, thumbnailURL := range thumbnailURLs {
+		if thumbnailURL == nil {
+			continue
+		}
+		if name, ok := strings.CutPrefix(*thumbnailURL, cfg.getAssetURL("/assets/")); ok {
+			err := os.Remove(cfg.getAssetDiskPath("/assets/" + name))
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+	}
+	return nil
+}
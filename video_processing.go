@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+var errNoOriginal = errors.New("video has no archived original")
+
+// processedVideo is the faststart output of a source file along with the
+// details probed from it.
+type processedVideo struct {
+	path        string
+	aspectRatio string
+	duration    float64
+	frameHashes []uint64
+}
+
+// processVideoFile runs the processing pipeline on a source file. The caller
+// is responsible for removing the processed file.
+func processVideoFile(sourcePath string) (processedVideo, error) {
+	processedFile, err := processVideoForFastStart(sourcePath)
+	if err != nil {
+		return processedVideo{}, fmt.Errorf("faststart: %w", err)
+	}
+
+	ratio, err := getVideoAspectRatio(processedFile)
+	if err != nil {
+		os.Remove(processedFile)
+		return processedVideo{}, fmt.Errorf("aspect ratio: %w", err)
+	}
+
+	duration, err := getMediaDuration(processedFile)
+	if err != nil {
+		os.Remove(processedFile)
+		return processedVideo{}, fmt.Errorf("duration: %w", err)
+	}
+
+	frameHashes, err := getFrameHashes(processedFile, duration)
+	if err != nil {
+		os.Remove(processedFile)
+		return processedVideo{}, fmt.Errorf("fingerprint: %w", err)
+	}
+
+	return processedVideo{
+		path:        processedFile,
+		aspectRatio: ratio,
+		duration:    duration,
+		frameHashes: frameHashes,
+	}, nil
+}
+
+// publishProcessedVideo uploads the processed file under a key prefixed by its
+// orientation and points the video record at it, recording a revision by
+// userID (uuid.Nil when the system made the change).
+func (cfg *apiConfig) publishProcessedVideo(ctx context.Context, video *database.Video, processed processedVideo, userID uuid.UUID) error {
+	ratioKey := "other"
+	if processed.aspectRatio == "16:9" {
+		ratioKey = "landscape"
+	} else if processed.aspectRatio == "9:16" {
+		ratioKey = "portrait"
+	}
+
+	rndmString, err := randomObjectName()
+	if err != nil {
+		return err
+	}
+	key := fmt.Sprintf("%s/%s.mp4", ratioKey, rndmString)
+
+	file, err := os.Open(processed.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	videoURL, err := cfg.putObject(ctx, key, "video/mp4", file)
+	if err != nil {
+		return err
+	}
+
+	video.VideoURL = &videoURL
+	video.Duration = &processed.duration
+	video.AspectRatio = &processed.aspectRatio
+	video.ProcessingStatus = database.ProcessingStatusReady
+	revised, err := cfg.db.ReviseVideoFile(ctx, *video, userID)
+	if err != nil {
+		return err
+	}
+	*video = revised
+	return nil
+}
+
+// setProcessingStatus records the outcome of processing even when the
+// request that started it has been cancelled.
+func (cfg *apiConfig) setProcessingStatus(ctx context.Context, videoID uuid.UUID, status string) {
+	err := cfg.db.SetVideoProcessingStatus(context.WithoutCancel(ctx), videoID, status)
+	if err != nil {
+		log.Printf("Couldn't set processing status of video %s: %v", videoID, err)
+	}
+}
+
+// archiveOriginal stores the untouched upload under originals/ using the
+// configured storage class and returns its key.
+func (cfg *apiConfig) archiveOriginal(ctx context.Context, file *os.File) (string, error) {
+	_, err := file.Seek(0, io.SeekStart)
+	if err != nil {
+		return "", err
+	}
+
+	rndmString, err := randomObjectName()
+	if err != nil {
+		return "", err
+	}
+	key := fmt.Sprintf("originals/%s.mp4", rndmString)
+
+	_, err = cfg.putObject(ctx, key, "video/mp4", file, func(input *s3.PutObjectInput) {
+		if cfg.originalsStorageClass != "" {
+			input.StorageClass = types.StorageClass(cfg.originalsStorageClass)
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// reprocessVideo rebuilds a video's processed output from its archived original.
+func (cfg *apiConfig) reprocessVideo(ctx context.Context, video database.Video) (database.Video, error) {
+	if video.OriginalKey == nil {
+		return database.Video{}, errNoOriginal
+	}
+
+	tempFile, err := os.CreateTemp("", "tubely-reprocess.mp4")
+	if err != nil {
+		return database.Video{}, err
+	}
+	defer os.Remove(tempFile.Name())
+	defer tempFile.Close()
+
+	hasher := sha256.New()
+	err = cfg.getObject(ctx, *video.OriginalKey, io.MultiWriter(tempFile, hasher))
+	if err != nil {
+		return database.Video{}, fmt.Errorf("download original: %w", err)
+	}
+
+	err = cfg.db.SetVideoProcessingStatus(ctx, video.ID, database.ProcessingStatusProcessing)
+	if err != nil {
+		return database.Video{}, err
+	}
+	published := false
+	restoreStatus := video.ProcessingStatus
+	defer func() {
+		if !published {
+			cfg.setProcessingStatus(ctx, video.ID, restoreStatus)
+		}
+	}()
+
+	processed, err := processVideoFile(tempFile.Name())
+	if err != nil {
+		restoreStatus = database.ProcessingStatusFailed
+		return database.Video{}, err
+	}
+	defer os.Remove(processed.path)
+
+	// Rebuild the audio rendition for videos that had one, which drops it if
+	// the original turns out to have no audio
+	if video.AudioURL != nil {
+		err = cfg.attachAudioRendition(ctx, &video, tempFile.Name())
+		if err != nil {
+			return database.Video{}, err
+		}
+	}
+
+	err = cfg.publishProcessedVideo(ctx, &video, processed, uuid.Nil)
+	if err != nil {
+		return database.Video{}, err
+	}
+	published = true
+
+	err = cfg.db.SaveFingerprint(ctx, database.Fingerprint{
+		VideoID:     video.ID,
+		UserID:      video.UserID,
+		ContentHash: hex.EncodeToString(hasher.Sum(nil)),
+		FrameHashes: processed.frameHashes,
+		Duration:    processed.duration,
+	})
+	if err != nil {
+		return database.Video{}, err
+	}
+
+	return video, nil
+}
+
+// reprocessAllVideos re-processes every video with an archived original,
+// logging and skipping failures. It returns how many videos succeeded.
+func (cfg *apiConfig) reprocessAllVideos(ctx context.Context) (int, error) {
+	videos, err := cfg.db.GetVideosWithOriginals(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	done := 0
+	for _, video := range videos {
+		if _, err := cfg.reprocessVideo(ctx, video); err != nil {
+			log.Printf("Couldn't reprocess video %s: %v", video.ID, err)
+			continue
+		}
+		done++
+	}
+	return done, nil
+}
+
+type audioFormat struct {
+	ext         string
+	contentType string
+	args        []string
+}
+
+var audioFormats = map[string]audioFormat{
+	"aac": {
+		ext:         "m4a",
+		contentType: "audio/mp4",
+		args:        []string{"-c:a", "aac", "-b:a", "128k", "-movflags", "faststart", "-f", "ipod"},
+	},
+	"mp3": {
+		ext:         "mp3",
+		contentType: "audio/mpeg",
+		args:        []string{"-c:a", "libmp3lame", "-b:a", "128k", "-f", "mp3"},
+	},
+}
+
+// attachAudioRendition extracts the audio track of the source in the
+// configured format, uploads it and records it on the video. Videos without
+// an audio stream get no rendition, and lose any left from an earlier
+// upload. The caller saves the video.
+func (cfg *apiConfig) attachAudioRendition(ctx context.Context, video *database.Video, sourcePath string) error {
+	format, ok := audioFormats[cfg.audioFormat]
+	if !ok {
+		return fmt.Errorf("unsupported audio format %q", cfg.audioFormat)
+	}
+
+	hasAudio, err := hasAudioStream(sourcePath)
+	if err != nil {
+		return err
+	}
+	if !hasAudio {
+		video.AudioURL = nil
+		video.AudioDuration = nil
+		return nil
+	}
+
+	audioFile, err := extractAudio(sourcePath, format)
+	if err != nil {
+		return fmt.Errorf("extract audio: %w", err)
+	}
+	defer os.Remove(audioFile)
+
+	duration, err := getMediaDuration(audioFile)
+	if err != nil {
+		return fmt.Errorf("audio duration: %w", err)
+	}
+
+	rndmString, err := randomObjectName()
+	if err != nil {
+		return err
+	}
+	key := fmt.Sprintf("audio/%s.%s", rndmString, format.ext)
+
+	file, err := os.Open(audioFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	audioURL, err := cfg.putObject(ctx, key, format.contentType, file)
+	if err != nil {
+		return err
+	}
+
+	video.AudioURL = &audioURL
+	video.AudioDuration = &duration
+	return nil
+}
+
+func extractAudio(filePath string, format audioFormat) (string, error) {
+	// Set output file path
+	outPath := filePath + ".audio." + format.ext
+
+	// Set the command, dropping the video stream
+	args := []string{"-i", filePath, "-vn"}
+	args = append(args, format.args...)
+	args = append(args, outPath)
+	cmd := exec.Command("ffmpeg", args...)
+
+	// Run the command
+	if err := cmd.Run(); err != nil {
+		return "", err
+	}
+
+	return outPath, nil
+}
+
+func hasAudioStream(filePath string) (bool, error) {
+	// Set the command
+	cmd := exec.Command(
+		"ffprobe",
+		"-v",
+		"error",
+		"-select_streams",
+		"a",
+		"-print_format",
+		"json",
+		"-show_streams",
+		filePath,
+	)
+
+	// Run the command
+	var b bytes.Buffer
+	cmd.Stdout = &b
+	err := cmd.Run()
+	if err != nil {
+		return false, err
+	}
+
+	type parameters struct {
+		Streams []struct {
+			Index int `json:"index"`
+		} `json:"streams"`
+	}
+
+	params := parameters{}
+	err = json.Unmarshal(b.Bytes(), &params)
+	if err != nil {
+		return false, err
+	}
+	return len(params.Streams) > 0, nil
+}
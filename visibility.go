@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// visibleTo reports whether a video or playlist can be read by userID, which
+// is uuid.Nil for anonymous requests. Only owners can read private ones.
+func visibleTo(visibility string, ownerID, userID uuid.UUID) bool {
+	return visibility != database.VisibilityPrivate || (userID != uuid.Nil && userID == ownerID)
+}
+
+func validateVisibility(visibility string) error {
+	switch visibility {
+	case database.VisibilityPrivate, database.VisibilityUnlisted, database.VisibilityPublic:
+		return nil
+	}
+	return fmt.Errorf("Visibility must be %s, %s or %s", database.VisibilityPrivate, database.VisibilityUnlisted, database.VisibilityPublic)
+}
+
+// optionalUserID returns the caller's user ID, or uuid.Nil for requests
+// without an Authorization header. A token that doesn't validate is an error.
+func (cfg *apiConfig) optionalUserID(r *http.Request) (uuid.UUID, error) {
+	token, err := auth.GetBearerToken(r.Header)
+	if errors.Is(err, auth.ErrNoAuthHeaderIncluded) {
+		return uuid.Nil, nil
+	}
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return cfg.validateJWT(r.Context(), token)
+}
+
+// getVisibleVideo loads the video named in the path if the caller may see
+// it, writing an error response when it can't. Private videos of other users
+// are reported as not found.
+func (cfg *apiConfig) getVisibleVideo(w http.ResponseWriter, r *http.Request) (database.Video, bool) {
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return database.Video{}, false
+	}
+
+	userID, err := cfg.optionalUserID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return database.Video{}, false
+	}
+
+	video, err := cfg.db.GetVideo(r.Context(), videoID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Couldn't find video", err)
+		return database.Video{}, false
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return database.Video{}, false
+	}
+	if !visibleTo(video.Visibility, video.UserID, userID) {
+		respondWithError(w, http.StatusNotFound, "Couldn't find video", nil)
+		return database.Video{}, false
+	}
+	return video, true
+}